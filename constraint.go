@@ -0,0 +1,188 @@
+package moku
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// constraint restricts the values a path param matches. It is defined by
+// appending a pattern in angle brackets to the path param, as in :id<int>. The
+// pattern is either one of the types int, uint and uuid, or a regular
+// expression that must match the whole value. Patterns cannot contain slashes.
+type constraint struct {
+	pattern string
+	kind    constraintKind
+	match   func(string) (uint64, bool)
+}
+
+// constraintKind tells how the typed value of a path param is to be
+// interpreted. Typed values are kept as uint64 so that they can be stored
+// without allocating.
+type constraintKind uint8
+
+const (
+	untyped constraintKind = iota
+	intKind
+	uintKind
+)
+
+// newConstraint creates a constraint from given pattern. It returns nil if the
+// pattern is empty.
+func newConstraint(pattern string) (*constraint, error) {
+	c := &constraint{pattern: pattern}
+	switch pattern {
+	case "":
+		return nil, nil
+	case "int":
+		c.kind = intKind
+		c.match = func(s string) (uint64, bool) {
+			n, ok := parseInt(s)
+			return uint64(n), ok
+		}
+	case "uint":
+		c.kind = uintKind
+		c.match = func(s string) (uint64, bool) {
+			n, ok := parseUint(s, math.MaxUint64>>(64-strconv.IntSize))
+			return n, ok
+		}
+	case "uuid":
+		c.match = func(s string) (uint64, bool) {
+			return 0, isUUID(s)
+		}
+	default:
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("%w '%s': %s", ErrInvalidConstraint, pattern, err)
+		}
+		c.match = func(s string) (uint64, bool) {
+			return 0, re.MatchString(s)
+		}
+	}
+	return c, nil
+}
+
+// check returns whether s satisfies c, along with the typed value of s if c
+// is of a type having one. A nil constraint is satisfied by any value.
+func (c *constraint) check(s string) (uint64, bool) {
+	if c == nil {
+		return 0, true
+	}
+	return c.match(s)
+}
+
+// typeKind returns the kind of the typed values of c. It is nil-safe.
+func (c *constraint) typeKind() constraintKind {
+	if c == nil {
+		return untyped
+	}
+	return c.kind
+}
+
+func (c *constraint) String() string {
+	if c == nil {
+		return ""
+	}
+	return c.pattern
+}
+
+// splitConstraint splits a path param definition such as id<int> into its
+// name and constraint pattern. It returns an error if the definition has an
+// angle bracket but no constraint pattern properly enclosed after a name.
+func splitConstraint(s string) (name string, pattern string, err error) {
+	i := strings.IndexByte(s, '<')
+	if i < 0 {
+		return s, "", nil
+	}
+	switch {
+	case !strings.HasSuffix(s, ">"):
+		return "", "", fmt.Errorf("%w '%s': missing '>'", ErrInvalidConstraint, s)
+	case i == len(s)-2:
+		return "", "", fmt.Errorf("%w '%s': empty pattern", ErrInvalidConstraint, s)
+	case i == 0:
+		return "", "", fmt.Errorf("%w '%s': empty path param name", ErrInvalidConstraint, s)
+	}
+	return s[:i], s[i+1 : len(s)-1], nil
+}
+
+// isUUID returns whether s is a UUID in its canonical textual form, such as
+// 123e4567-e89b-12d3-a456-426614174000.
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return false
+			}
+		default:
+			c := s[i]
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// parseInt parses s as a decimal int, optionally signed, like strconv.Atoi
+// does but without allocating if s is not a valid int.
+func parseInt(s string) (int, bool) {
+	neg := false
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		neg, s = s[0] == '-', s[1:]
+	}
+	max := uint64(math.MaxUint64>>(64-strconv.IntSize)) >> 1
+	if neg {
+		n, ok := parseUint(s, max+1)
+		return int(-n), ok
+	}
+	n, ok := parseUint(s, max)
+	return int(n), ok
+}
+
+// parseUint parses s as an unsigned decimal number no greater than max,
+// without allocating if s is not valid.
+func parseUint(s string, max uint64) (uint64, bool) {
+	if s == "" {
+		return 0, false
+	}
+	var n uint64
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		d := uint64(c - '0')
+		if n > (max-d)/10 {
+			return 0, false
+		}
+		n = n*10 + d
+	}
+	return n, true
+}
+
+// PathParamInt extracts the value of a path param having the int constraint
+// from given context. The value is parsed when the route is matched. ok is
+// false if there is no such path param.
+func PathParamInt(ctx context.Context, name string) (value int, ok bool) {
+	if v, found := ParamsFromContext(ctx).lookup(name); found && v.kind == intKind {
+		return int(v.num), true
+	}
+	return 0, false
+}
+
+// PathParamUint extracts the value of a path param having the uint
+// constraint from given context. The value is parsed when the route is
+// matched. ok is false if there is no such path param.
+func PathParamUint(ctx context.Context, name string) (value uint, ok bool) {
+	if v, found := ParamsFromContext(ctx).lookup(name); found && v.kind == uintKind {
+		return uint(v.num), true
+	}
+	return 0, false
+}
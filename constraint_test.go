@@ -0,0 +1,200 @@
+package moku
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestMuxPathParamConstraints(t *testing.T) {
+	mux := newMuxWithGetPaths([]string{
+		"/users/:id<int>",
+		"/users/:id<uuid>",
+		"/users/:id",
+		"/posts/:slug<[a-z-]+>",
+		"/posts/:slug<[a-z-]+>/comments",
+		"/files/:n<uint>",
+		"/files/*rest",
+	})
+
+	expectations := []struct {
+		requestedPath string
+		expectedBody  string
+		expectedCode  int
+	}{
+		{"/users/42", "/users/:id<int>", http.StatusOK},
+		{"/users/-42", "/users/:id<int>", http.StatusOK},
+		{"/users/123e4567-e89b-12d3-a456-426614174000", "/users/:id<uuid>", http.StatusOK},
+		{"/users/123e4567-e89b-12d3-a456-42661417400", "/users/:id", http.StatusOK},
+		{"/users/foo", "/users/:id", http.StatusOK},
+		{"/posts/hello-world", "/posts/:slug<[a-z-]+>", http.StatusOK},
+		{"/posts/hello-world/comments", "/posts/:slug<[a-z-]+>/comments", http.StatusOK},
+		{"/posts/Hello", "", http.StatusNotFound},
+		{"/posts/hello1", "", http.StatusNotFound},
+		{"/files/5", "/files/:n<uint>", http.StatusOK},
+		{"/files/-5", "/files/*rest", http.StatusOK},
+	}
+	for _, e := range expectations {
+		assertStatus(t, mux, "GET", e.requestedPath, e.expectedCode)
+		if e.expectedCode == http.StatusOK {
+			assertBodyEquals(t, mux, "GET", e.requestedPath, e.expectedBody)
+		}
+	}
+}
+
+func TestPathParamInt(t *testing.T) {
+	mux := New()
+	mux.GetFunc("/a/:id<int>/:n<uint>/:s", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		id, idOK := PathParamInt(ctx, "id")
+		n, nOK := PathParamUint(ctx, "n")
+		_, sOK := PathParamInt(ctx, "s")
+		fmt.Fprintf(w, "%d %t %d %t %t %s", id, idOK, n, nOK, sOK, PathParams(ctx)["id"])
+	})
+
+	assertBodyEquals(t, mux, "GET", "/a/-7/8/9", "-7 true 8 true false -7")
+	assertStatus(t, mux, "GET", "/a/x/8/9", http.StatusNotFound)
+	assertStatus(t, mux, "GET", "/a/7/-8/9", http.StatusNotFound)
+
+	if _, ok := PathParamInt(context.Background(), "id"); ok {
+		t.Errorf("Expected no path param in empty context")
+	}
+}
+
+func TestMuxPathParamConstraintsCaseInsensitive(t *testing.T) {
+	mux := New()
+	mux.RedirectCaseInsensitive = true
+	mux.GetFunc("/users/:id<int>", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "user")
+	})
+
+	assertHeader(t, mux, "GET", "/Users/42", "Location", "/users/42")
+	assertStatus(t, mux, "GET", "/Users/foo", http.StatusNotFound)
+}
+
+func TestInvalidPathParamConstraint(t *testing.T) {
+	mux := New()
+	for _, path := range []string{
+		"/foo/:id<[a-z>",
+		"/foo/:id<int",
+		"/foo/:id<>",
+		"/foo/:<int>",
+		"/foo/:<>",
+	} {
+		err := mux.GetFunc(path, func(ctx context.Context, w http.ResponseWriter, r *http.Request) {})
+		var routeErr *RouteError
+		if !errors.As(err, &routeErr) || !errors.Is(err, ErrInvalidConstraint) {
+			t.Errorf("Expected *RouteError wrapping ErrInvalidConstraint adding %s, got %v", path, err)
+			continue
+		}
+		if routeErr.Segment != 1 {
+			t.Errorf("Expected error at segment 1 adding %s, got %d", path, routeErr.Segment)
+		}
+	}
+	assertStatus(t, mux, "GET", "/foo/5", http.StatusNotFound)
+}
+
+func TestSplitConstraint(t *testing.T) {
+	expectations := []struct {
+		s               string
+		expectedName    string
+		expectedPattern string
+		expectedErr     bool
+	}{
+		{"id", "id", "", false},
+		{"id<int>", "id", "int", false},
+		{"slug<[a-z-]+>", "slug", "[a-z-]+", false},
+		{"id<<a>>", "id", "<a>", false},
+		{"id<int", "", "", true},
+		{"id<>", "", "", true},
+		{"<int>", "", "", true},
+		{"<>", "", "", true},
+	}
+	for _, e := range expectations {
+		name, pattern, err := splitConstraint(e.s)
+		if name != e.expectedName || pattern != e.expectedPattern || (err != nil) != e.expectedErr {
+			t.Errorf(
+				"splitConstraint(%q) = %q, %q, %v, expected %q, %q, error %t",
+				e.s, name, pattern, err, e.expectedName, e.expectedPattern, e.expectedErr,
+			)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidConstraint) {
+			t.Errorf("Expected splitConstraint(%q) error to be ErrInvalidConstraint, got %v", e.s, err)
+		}
+	}
+}
+
+func TestIsUUID(t *testing.T) {
+	expectations := map[string]bool{
+		"123e4567-e89b-12d3-a456-426614174000": true,
+		"123E4567-E89B-12D3-A456-426614174000": true,
+		"123e4567e89b12d3a456426614174000":     false,
+		"123e4567-e89b-12d3-a456-42661417400g": false,
+		"123e4567-e89b-12d3-a456_426614174000": false,
+		"":                                     false,
+	}
+	for s, expected := range expectations {
+		if got := isUUID(s); got != expected {
+			t.Errorf("isUUID(%q) = %t, expected %t", s, got, expected)
+		}
+	}
+}
+
+func TestParseInt(t *testing.T) {
+	expectations := []struct {
+		s          string
+		expected   int
+		expectedOk bool
+	}{
+		{"0", 0, true},
+		{"42", 42, true},
+		{"+42", 42, true},
+		{"-42", -42, true},
+		{"007", 7, true},
+		{strconv.Itoa(math.MaxInt64), math.MaxInt64, true},
+		{strconv.Itoa(math.MinInt64), math.MinInt64, true},
+		{"9223372036854775808", 0, false},
+		{"-9223372036854775809", 0, false},
+		{"", 0, false},
+		{"-", 0, false},
+		{"4 2", 0, false},
+		{"0x2a", 0, false},
+	}
+	for _, e := range expectations {
+		n, ok := parseInt(e.s)
+		if n != e.expected || ok != e.expectedOk {
+			t.Errorf("parseInt(%q) = %d, %t, expected %d, %t", e.s, n, ok, e.expected, e.expectedOk)
+		}
+		_, err := strconv.Atoi(e.s)
+		if ok != (err == nil) {
+			t.Errorf("parseInt(%q) ok = %t, strconv.Atoi error %v", e.s, ok, err)
+		}
+	}
+}
+
+func TestParseUint(t *testing.T) {
+	expectations := []struct {
+		s          string
+		max        uint64
+		expected   uint64
+		expectedOk bool
+	}{
+		{"0", math.MaxUint64, 0, true},
+		{"18446744073709551615", math.MaxUint64, math.MaxUint64, true},
+		{"18446744073709551616", math.MaxUint64, 0, false},
+		{"255", 255, 255, true},
+		{"256", 255, 0, false},
+		{"+1", math.MaxUint64, 0, false},
+		{"", math.MaxUint64, 0, false},
+	}
+	for _, e := range expectations {
+		n, ok := parseUint(e.s, e.max)
+		if n != e.expected || ok != e.expectedOk {
+			t.Errorf("parseUint(%q, %d) = %d, %t, expected %d, %t", e.s, e.max, n, ok, e.expected, e.expectedOk)
+		}
+	}
+}
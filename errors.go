@@ -0,0 +1,113 @@
+package moku
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors returned by the mux when adding, removing or replacing routes or
+// mounting handlers. They are wrapped in a *RouteError and can be tested for
+// using errors.Is.
+var (
+	ErrInvalidMethod        = errors.New("Method is not a valid HTTP token")
+	ErrEmptyPath            = errors.New("Path is empty")
+	ErrNoLeadingSlash       = errors.New("Path does not begin with leading slash")
+	ErrCatchAllNotLast      = errors.New("Catch-all path param is not the last path segment")
+	ErrEmptyParamName       = errors.New("Path param name is empty")
+	ErrInvalidConstraint    = errors.New("Invalid path param constraint")
+	ErrPathParamConflict    = errors.New("Path param already defined")
+	ErrDuplicateRoute       = errors.New("Route already defined")
+	ErrRouteNotDefined      = errors.New("Route not defined")
+	ErrMountPrefixNotStatic = errors.New("Mount prefix is not static")
+)
+
+// RouteError is the error returned when a route cannot be added, removed or
+// replaced. Err holds the reason, which is or wraps one of the errors above.
+type RouteError struct {
+	Method string // * for mounts
+	Path   string
+
+	// Segment is the index of the path segment the error concerns, counting
+	// from 0 after the leading slash, or -1 if it concerns no single segment.
+	Segment int
+
+	Err error
+}
+
+func (e *RouteError) Error() string {
+	if e.Segment < 0 {
+		return fmt.Sprintf("%s %s: %s", e.Method, e.Path, e.Err)
+	}
+	return fmt.Sprintf("%s %s (segment %d): %s", e.Method, e.Path, e.Segment, e.Err)
+}
+
+// Unwrap returns the reason of the error.
+func (e *RouteError) Unwrap() error {
+	return e.Err
+}
+
+// RouteErrors is the error returned by Routes, listing the errors of all
+// routes that could not be added.
+type RouteErrors []*RouteError
+
+func (e RouteErrors) Error() string {
+	s := make([]string, len(e))
+	for n, err := range e {
+		s[n] = err.Error()
+	}
+	return strings.Join(s, "; ")
+}
+
+// Is reports whether any of the errors is target, for use with errors.Is.
+func (e RouteErrors) Is(target error) bool {
+	for _, err := range e {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first of the errors that matches target, for use with
+// errors.As.
+func (e RouteErrors) As(target interface{}) bool {
+	for _, err := range e {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRoute returns a *RouteError if method is not a valid HTTP method, or if
+// path is empty or does not begin with a slash.
+func checkRoute(method string, path string) error {
+	switch {
+	case !isToken(method):
+		return &RouteError{Method: method, Path: path, Segment: -1, Err: ErrInvalidMethod}
+	case path == "":
+		return &RouteError{Method: method, Path: path, Segment: -1, Err: ErrEmptyPath}
+	case path[0] != '/':
+		return &RouteError{Method: method, Path: path, Segment: 0, Err: ErrNoLeadingSlash}
+	}
+	return nil
+}
+
+// isToken reports whether s is a token as defined by RFC 7230, which methods
+// are required to be.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+			continue
+		}
+		if strings.IndexByte("!#$%&'*+-.^_`|~", c) < 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package moku
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRouteError(t *testing.T) {
+	mux := New()
+	mux.GetFunc("/foo/*rest", nil)
+	mux.RejectDuplicateRoutes = true
+	mux.GetFunc("/bar", nil)
+
+	expectations := []struct {
+		method          string
+		path            string
+		remove          bool
+		expectedErr     error
+		expectedSegment int
+		expectedMessage string
+	}{
+		{"", "/foo", false, ErrInvalidMethod, -1, " /foo: Method is not a valid HTTP token"},
+		{"GET", "", false, ErrEmptyPath, -1, "GET : Path is empty"},
+		{"GET", "foo", false, ErrNoLeadingSlash, 0, "GET foo (segment 0): Path does not begin with leading slash"},
+		{"GET", "/foo/*rest/bar", false, ErrCatchAllNotLast, 1, "GET /foo/*rest/bar (segment 1): Catch-all path param is not the last path segment"},
+		{"GET", "/foo/:id<[a-z>", false, ErrInvalidConstraint, 1, ""},
+		{"GET", "/foo/*path", false, ErrPathParamConflict, 1, "GET /foo/*path (segment 1): Path param already defined: '*path' as '*rest'"},
+		{"GET", "/bar", false, ErrDuplicateRoute, -1, "GET /bar: Route already defined"},
+		{"G T", "/bar", true, ErrInvalidMethod, -1, "G T /bar: Method is not a valid HTTP token"},
+		{"GET", "", true, ErrEmptyPath, -1, "GET : Path is empty"},
+		{"GET", "bar", true, ErrNoLeadingSlash, 0, "GET bar (segment 0): Path does not begin with leading slash"},
+		{"GET", "/baz", true, ErrRouteNotDefined, -1, "GET /baz: Route not defined"},
+		{"POST", "/bar", true, ErrRouteNotDefined, -1, "POST /bar: Route not defined"},
+	}
+	for _, e := range expectations {
+		var err error
+		if e.remove {
+			err = mux.Remove(e.method, e.path)
+		} else {
+			err = mux.addRoute(e.method, e.path, nil)
+		}
+		var routeErr *RouteError
+		if !errors.As(err, &routeErr) {
+			t.Errorf("Expected *RouteError for %s %q, got %v", e.method, e.path, err)
+			continue
+		}
+		if !errors.Is(err, e.expectedErr) {
+			t.Errorf("Expected error for %s %q to be %q, got %q", e.method, e.path, e.expectedErr, err)
+		}
+		if routeErr.Method != e.method || routeErr.Path != e.path || routeErr.Segment != e.expectedSegment {
+			t.Errorf(
+				"Expected error for %s %q at segment %d, got %s %q at segment %d",
+				e.method, e.path, e.expectedSegment, routeErr.Method, routeErr.Path, routeErr.Segment,
+			)
+		}
+		if e.expectedMessage != "" && err.Error() != e.expectedMessage {
+			t.Errorf("Expected error message %q, got %q", e.expectedMessage, err)
+		}
+	}
+}
+
+func TestRouteErrors(t *testing.T) {
+	err := error(RouteErrors{
+		{Method: "GET", Path: "foo", Segment: 0, Err: ErrNoLeadingSlash},
+		{Method: "GET", Path: "/bar", Segment: -1, Err: ErrDuplicateRoute},
+	})
+	expectedMessage := "GET foo (segment 0): Path does not begin with leading slash; GET /bar: Route already defined"
+	if err.Error() != expectedMessage {
+		t.Errorf("Expected %q, got %q", expectedMessage, err)
+	}
+	if !errors.Is(err, ErrNoLeadingSlash) || !errors.Is(err, ErrDuplicateRoute) {
+		t.Errorf("Expected %q to be both ErrNoLeadingSlash and ErrDuplicateRoute", err)
+	}
+	if errors.Is(err, ErrEmptyPath) {
+		t.Errorf("Expected %q not to be ErrEmptyPath", err)
+	}
+	var routeErr *RouteError
+	if !errors.As(err, &routeErr) || routeErr.Path != "foo" {
+		t.Errorf("Expected first error as *RouteError, got %v", routeErr)
+	}
+}
+
+func TestIsToken(t *testing.T) {
+	for _, s := range []string{"GET", "PROPFIND", "get", "X-Custom_1", "!#$%&'*+-.^_`|~", "0"} {
+		if !isToken(s) {
+			t.Errorf("Expected %q to be a token", s)
+		}
+	}
+	for _, s := range []string{"", "G T", "GET/", "(GET)", "MÉTHOD", "GET\t", "a:b", "\"GET\""} {
+		if isToken(s) {
+			t.Errorf("Expected %q not to be a token", s)
+		}
+	}
+}
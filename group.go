@@ -0,0 +1,152 @@
+package moku
+
+// Group is a set of routes sharing a path prefix and middleware. Create an
+// instance of Group using Mux.Group() or Group.Group().
+type Group struct {
+	mux        *Mux
+	parent     *Group
+	prefix     string
+	middleware []Middleware
+}
+
+// Group creates a route group. Routes defined on the group have the prefix
+// prepended to their paths, so that with prefix /api a route /users is defined
+// as /api/users.
+func (m *Mux) Group(prefix string) *Group {
+	return &Group{mux: m, prefix: prefix}
+}
+
+// Group creates a nested route group. Its prefix is appended to the prefix of
+// g, and its middleware is run inside the middleware of g.
+func (g *Group) Group(prefix string) *Group {
+	return &Group{mux: g.mux, parent: g, prefix: g.prefix + prefix}
+}
+
+// With creates a group with the same prefix as g and given middleware added,
+// for defining routes with middleware of their own.
+func (g *Group) With(middleware ...Middleware) *Group {
+	return &Group{mux: g.mux, parent: g, prefix: g.prefix, middleware: append([]Middleware(nil), middleware...)}
+}
+
+// Use adds middleware to the group. Middleware is run in the order added, and
+// only applies to routes defined on the group after the call.
+func (g *Group) Use(middleware ...Middleware) {
+	g.middleware = append(g.middleware, middleware...)
+}
+
+// wrap wraps handler in the middleware of g and its parents.
+func (g *Group) wrap(handler Handler) Handler {
+	if handler == nil {
+		return nil
+	}
+	handler = chain(g.middleware, handler)
+	if g.parent != nil {
+		return g.parent.wrap(handler)
+	}
+	return handler
+}
+
+func (g *Group) addRoute(method string, path string, handler Handler) error {
+	return g.mux.addRoute(method, g.prefix+path, g.wrap(nilIfNilFunc(handler)))
+}
+
+// Handle configures a route of given method, which may be any valid HTTP
+// method.
+func (g *Group) Handle(method string, path string, handler Handler) error {
+	return g.addRoute(method, path, handler)
+}
+
+// HandleFunc configures a route of given method.
+func (g *Group) HandleFunc(method string, path string, handler HandlerFunc) error {
+	return g.Handle(method, path, handler)
+}
+
+// Any configures routes of all standard methods, see Mux.Any.
+func (g *Group) Any(path string, handler Handler) error {
+	return g.mux.Any(g.prefix+path, g.wrap(nilIfNilFunc(handler)))
+}
+
+// AnyFunc configures routes of all standard methods.
+func (g *Group) AnyFunc(path string, handler HandlerFunc) error {
+	return g.Any(path, handler)
+}
+
+// Delete configures a DELETE route.
+func (g *Group) Delete(path string, handler Handler) error {
+	return g.addRoute("DELETE", path, handler)
+}
+
+// DeleteFunc configures a DELETE route.
+func (g *Group) DeleteFunc(path string, handler HandlerFunc) error {
+	return g.Delete(path, handler)
+}
+
+// Get configures a GET route.
+func (g *Group) Get(path string, handler Handler) error {
+	return g.addRoute("GET", path, handler)
+}
+
+// GetFunc configures a GET route.
+func (g *Group) GetFunc(path string, handler HandlerFunc) error {
+	return g.Get(path, handler)
+}
+
+// Head configures a HEAD route.
+func (g *Group) Head(path string, handler Handler) error {
+	return g.addRoute("HEAD", path, handler)
+}
+
+// HeadFunc configures a HEAD route.
+func (g *Group) HeadFunc(path string, handler HandlerFunc) error {
+	return g.Head(path, handler)
+}
+
+// Options configures an OPTIONS route.
+func (g *Group) Options(path string, handler Handler) error {
+	return g.addRoute("OPTIONS", path, handler)
+}
+
+// OptionsFunc configures an OPTIONS route.
+func (g *Group) OptionsFunc(path string, handler HandlerFunc) error {
+	return g.Options(path, handler)
+}
+
+// Patch configures a PATCH route.
+func (g *Group) Patch(path string, handler Handler) error {
+	return g.addRoute("PATCH", path, handler)
+}
+
+// PatchFunc configures a PATCH route.
+func (g *Group) PatchFunc(path string, handler HandlerFunc) error {
+	return g.Patch(path, handler)
+}
+
+// Post configures a POST route.
+func (g *Group) Post(path string, handler Handler) error {
+	return g.addRoute("POST", path, handler)
+}
+
+// PostFunc configures a POST route.
+func (g *Group) PostFunc(path string, handler HandlerFunc) error {
+	return g.Post(path, handler)
+}
+
+// Put configures a PUT route.
+func (g *Group) Put(path string, handler Handler) error {
+	return g.addRoute("PUT", path, handler)
+}
+
+// PutFunc configures a PUT route.
+func (g *Group) PutFunc(path string, handler HandlerFunc) error {
+	return g.Put(path, handler)
+}
+
+// Trace configures a TRACE route.
+func (g *Group) Trace(path string, handler Handler) error {
+	return g.addRoute("TRACE", path, handler)
+}
+
+// TraceFunc configures a TRACE route.
+func (g *Group) TraceFunc(path string, handler HandlerFunc) error {
+	return g.Trace(path, handler)
+}
@@ -0,0 +1,78 @@
+package moku
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func writeMiddleware(s string) Middleware {
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, s)
+			next.ServeHTTPC(ctx, w, r)
+		})
+	}
+}
+
+func TestGroup(t *testing.T) {
+	mux := New()
+	api := mux.Group("/api")
+	api.Use(writeMiddleware("api,"))
+	v1 := api.Group("/v1")
+	v1.Use(writeMiddleware("v1a,"), writeMiddleware("v1b,"))
+	v1.GetFunc("/users/:id", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "user "+PathParams(ctx)["id"])
+	})
+	v1.PostFunc("/users/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "created")
+	})
+	api.GetFunc("", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "root")
+	})
+
+	assertBodyEquals(t, mux, "GET", "/api/v1/users/5", "api,v1a,v1b,user 5")
+	assertBodyEquals(t, mux, "POST", "/api/v1/users/", "api,v1a,v1b,created")
+	assertBodyEquals(t, mux, "GET", "/api", "api,root")
+	assertStatus(t, mux, "GET", "/api/", http.StatusMovedPermanently)
+	assertHeader(t, mux, "GET", "/api/", "Location", "/api")
+	assertStatus(t, mux, "POST", "/api/v1/users", http.StatusTemporaryRedirect)
+	assertStatus(t, mux, "GET", "/v1/users/5", http.StatusNotFound)
+}
+
+func TestGroupUseAfterRoute(t *testing.T) {
+	mux := New()
+	g := mux.Group("/foo")
+	g.GetFunc("/before", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {})
+	g.Use(writeMiddleware("mw"))
+	g.GetFunc("/after", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {})
+
+	assertBodyEquals(t, mux, "GET", "/foo/before", "")
+	assertBodyEquals(t, mux, "GET", "/foo/after", "mw")
+}
+
+func TestGroupWithoutLeadingSlash(t *testing.T) {
+	mux := New()
+	err := mux.Group("foo").GetFunc("/bar", nil)
+	if !errors.Is(err, ErrNoLeadingSlash) {
+		t.Errorf("Expected ErrNoLeadingSlash, got %v", err)
+	}
+}
+
+func TestGroupHandle(t *testing.T) {
+	mux := New()
+	g := mux.Group("/dav")
+	g.Use(writeMiddleware("dav,"))
+	g.HandleFunc("PROPFIND", "/:file", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "propfind "+PathParams(ctx)["file"])
+	})
+	g.AnyFunc("/any", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "any")
+	})
+
+	assertBodyEquals(t, mux, "PROPFIND", "/dav/foo", "dav,propfind foo")
+	assertBodyEquals(t, mux, "PUT", "/dav/any", "dav,any")
+	assertBodyEquals(t, mux, "PROPFIND", "/dav/any", "dav,propfind any")
+}
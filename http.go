@@ -0,0 +1,87 @@
+package moku
+
+import (
+	"context"
+	"net/http"
+)
+
+// HTTPHandler adapts an http.Handler to a Handler. The context passed to the
+// Handler, carrying the path params of the request, is attached to the
+// request, so that the http.Handler gets path params using
+// PathParams(r.Context()).
+func HTTPHandler(h http.Handler) Handler {
+	switch h := h.(type) {
+	case nil:
+		return nil
+	case http.HandlerFunc:
+		if h == nil {
+			return nil
+		}
+	case stdHandler:
+		return h.handler
+	}
+	return httpHandler{h}
+}
+
+// HTTPHandlerFunc adapts an http.HandlerFunc to a Handler, see HTTPHandler.
+func HTTPHandlerFunc(f http.HandlerFunc) Handler {
+	if f == nil {
+		return nil
+	}
+	return httpHandler{f}
+}
+
+type httpHandler struct {
+	handler http.Handler
+}
+
+func (h httpHandler) ServeHTTPC(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	if ctx != r.Context() {
+		r = r.WithContext(ctx)
+	}
+	h.handler.ServeHTTP(w, r)
+}
+
+// StdHandler adapts a Handler to an http.Handler, which calls the Handler with
+// the context of the request.
+func StdHandler(h Handler) http.Handler {
+	switch h := h.(type) {
+	case nil:
+		return nil
+	case httpHandler:
+		return h.handler
+	}
+	return stdHandler{h}
+}
+
+type stdHandler struct {
+	handler Handler
+}
+
+func (h stdHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.handler.ServeHTTPC(r.Context(), w, r)
+}
+
+// HandleHTTP configures a route of given method with an http.Handler, see
+// HTTPHandler.
+func (m *Mux) HandleHTTP(method string, path string, handler http.Handler) error {
+	return m.Handle(method, path, HTTPHandler(handler))
+}
+
+// HandleHTTPFunc configures a route of given method with an http.HandlerFunc,
+// see HTTPHandler.
+func (m *Mux) HandleHTTPFunc(method string, path string, handler http.HandlerFunc) error {
+	return m.Handle(method, path, HTTPHandlerFunc(handler))
+}
+
+// HandleHTTP configures a route of given method with an http.Handler, see
+// HTTPHandler.
+func (g *Group) HandleHTTP(method string, path string, handler http.Handler) error {
+	return g.Handle(method, path, HTTPHandler(handler))
+}
+
+// HandleHTTPFunc configures a route of given method with an http.HandlerFunc,
+// see HTTPHandler.
+func (g *Group) HandleHTTPFunc(method string, path string, handler http.HandlerFunc) error {
+	return g.Handle(method, path, HTTPHandlerFunc(handler))
+}
@@ -0,0 +1,60 @@
+package moku
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMuxHandleHTTP(t *testing.T) {
+	mux := New()
+	writeParam := func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "user "+PathParams(r.Context())["id"])
+	}
+	if err := mux.HandleHTTPFunc("GET", "/users/:id", writeParam); err != nil {
+		t.Errorf("Got error handling http.HandlerFunc: %s", err)
+	}
+	if err := mux.HandleHTTP("PUT", "/users/:id", http.HandlerFunc(writeParam)); err != nil {
+		t.Errorf("Got error handling http.Handler: %s", err)
+	}
+	mux.Group("/api").HandleHTTPFunc("GET", "/users/:id", writeParam)
+
+	assertBodyEquals(t, mux, "GET", "/users/5", "user 5")
+	assertBodyEquals(t, mux, "PUT", "/users/6", "user 6")
+	assertBodyEquals(t, mux, "GET", "/api/users/7", "user 7")
+
+	mux.HandleHTTPFunc("GET", "/nil", nil)
+	assertStatus(t, mux, "GET", "/nil", http.StatusNotFound)
+	mux.HandleHTTP("GET", "/nilfunc", http.HandlerFunc(nil))
+	assertStatus(t, mux, "GET", "/nilfunc", http.StatusNotFound)
+}
+
+func TestStdHandler(t *testing.T) {
+	type key struct{}
+	h := StdHandler(HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, ctx.Value(key{}).(string))
+	}))
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+	h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), key{}, "value")))
+	if w.Body.String() != "value" {
+		t.Errorf("Expected request context to be passed, got %q", w.Body.String())
+	}
+}
+
+func TestHTTPHandlerRoundTrip(t *testing.T) {
+	var f http.HandlerFunc = func(w http.ResponseWriter, r *http.Request) {}
+	if _, ok := StdHandler(HTTPHandlerFunc(f)).(http.HandlerFunc); !ok {
+		t.Error("Expected StdHandler to unwrap adapted http.Handler")
+	}
+	var h HandlerFunc = func(ctx context.Context, w http.ResponseWriter, r *http.Request) {}
+	if _, ok := HTTPHandler(StdHandler(h)).(HandlerFunc); !ok {
+		t.Error("Expected HTTPHandler to unwrap adapted Handler")
+	}
+	if HTTPHandler(nil) != nil || HTTPHandler(http.HandlerFunc(nil)) != nil ||
+		HTTPHandlerFunc(nil) != nil || StdHandler(nil) != nil {
+		t.Error("Expected nil handlers to be adapted to nil")
+	}
+}
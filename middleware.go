@@ -0,0 +1,34 @@
+package moku
+
+// Middleware wraps a Handler, returning a new Handler
+type Middleware func(Handler) Handler
+
+// Use adds middleware to the mux. Middleware is run in the order added for
+// every request served by the mux, before the route is looked up. It thus also
+// wraps redirects and 404 and 405 responses. Path params are available to
+// middleware once the handler passed to it has been called.
+func (m *Mux) Use(middleware ...Middleware) {
+	m.update(func(r *routes) error {
+		r.middleware = append(r.middleware[:len(r.middleware):len(r.middleware)], middleware...)
+		r.handler = chain(r.middleware, HandlerFunc(m.route))
+		return nil
+	})
+}
+
+// With creates a group without prefix with given middleware, for defining
+// routes with middleware of their own. The middleware is run after that added
+// to the mux using Use.
+//
+//	mux.With(auth).GetFunc("/admin", adminHandler)
+func (m *Mux) With(middleware ...Middleware) *Group {
+	return &Group{mux: m, middleware: append([]Middleware(nil), middleware...)}
+}
+
+// chain wraps handler in middleware so that the first middleware is the
+// outermost.
+func chain(middleware []Middleware, handler Handler) Handler {
+	for n := len(middleware) - 1; n >= 0; n-- {
+		handler = middleware[n](handler)
+	}
+	return handler
+}
@@ -0,0 +1,92 @@
+package moku
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestMuxUse(t *testing.T) {
+	mux := New()
+	mux.GetFunc("/foo", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "foo,")
+	})
+	mux.PostFunc("/baz", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {})
+	mux.Use(writeMiddleware("a,"), writeMiddleware("b,"))
+
+	assertBodyEquals(t, mux, "GET", "/foo", "a,b,foo,")
+	assertStatus(t, mux, "GET", "/foo", http.StatusOK)
+	assertBodyEquals(t, mux, "GET", "/undefined", "a,b,404 page not found\n")
+	assertBodyEquals(t, mux, "GET", "/baz", "a,b,Method Not Allowed\n")
+}
+
+func TestMuxUseStatus(t *testing.T) {
+	mux := New()
+	mux.GetFunc("/foo", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {})
+	mux.Use(func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Middleware", "yes")
+			next.ServeHTTPC(ctx, w, r)
+		})
+	})
+
+	assertHeader(t, mux, "GET", "/foo", "X-Middleware", "yes")
+	assertHeader(t, mux, "GET", "/foo/", "X-Middleware", "yes")
+	assertStatus(t, mux, "GET", "/foo/", http.StatusMovedPermanently)
+	assertHeader(t, mux, "GET", "/undefined", "X-Middleware", "yes")
+}
+
+func TestMuxUsePathParams(t *testing.T) {
+	mux := New()
+	mux.GetFunc("/foo/:id", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {})
+	mux.Use(func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTPC(ctx, w, r)
+			io.WriteString(w, "id="+PathParams(ctx)["id"])
+		})
+	})
+
+	assertBodyEquals(t, mux, "GET", "/foo/5", "id=5")
+}
+
+func TestMuxWith(t *testing.T) {
+	mux := New()
+	mux.Use(writeMiddleware("global,"))
+	mux.With(writeMiddleware("route,")).GetFunc("/foo", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "foo")
+	})
+	mux.GetFunc("/bar", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "bar")
+	})
+	api := mux.Group("/api")
+	api.Use(writeMiddleware("api,"))
+	api.With(writeMiddleware("route,")).GetFunc("/baz", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "baz")
+	})
+
+	assertBodyEquals(t, mux, "GET", "/foo", "global,route,foo")
+	assertBodyEquals(t, mux, "GET", "/bar", "global,bar")
+	assertBodyEquals(t, mux, "GET", "/api/baz", "global,api,route,baz")
+}
+
+func TestMuxWithCopiesMiddleware(t *testing.T) {
+	mux := New()
+	mws := make([]Middleware, 1, 2)
+	mws[0] = writeMiddleware("shared,")
+	foo := mux.With(mws...)
+	bar := mux.Group("/api").With(mws...)
+	baz := mux.With(mws...)
+	foo.Use(writeMiddleware("foo,"))
+	bar.Use(writeMiddleware("bar,"))
+	baz.Use(writeMiddleware("baz,"))
+	mws[0] = writeMiddleware("changed,")
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {}
+	foo.GetFunc("/foo", handler)
+	bar.GetFunc("/bar", handler)
+	baz.GetFunc("/baz", handler)
+
+	assertBodyEquals(t, mux, "GET", "/foo", "shared,foo,")
+	assertBodyEquals(t, mux, "GET", "/api/bar", "shared,bar,")
+	assertBodyEquals(t, mux, "GET", "/baz", "shared,baz,")
+}
@@ -1,20 +1,27 @@
 // Package moku provides a simple but powerful tree-based HTTP router.
+//
+// Handlers are passed a context.Context of the standard library. Handlers
+// written for golang.org/x/net/context work as they are, since its Context is
+// an alias of context.Context.
 package moku
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"net/http"
+	pathpkg "path"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
-
-	"golang.org/x/net/context"
+	"sync/atomic"
 )
 
 type contextKey int
 
 const (
 	pathParamsKey contextKey = iota
+	mountKey
 )
 
 // Handler is http.Handler with added context
@@ -36,17 +43,34 @@ func (f HandlerFunc) ServeHTTPC(ctx context.Context, w http.ResponseWriter, r *h
 
 // Mux is the router/muxer. Create an instance of Mux using New().
 type Mux struct {
-	sync.RWMutex
-	rootNode *node
+	sync.RWMutex              // held while replacing the routes snapshot
+	snapshot     atomic.Value // *routes
 
 	/*
-	   ConcurrentAdd (default true) can be set to false if routes will not be
-	   added while the router is serving requests, for higher throughput. Setting
-	   this to false will avoid taking a read lock on the routes tree on each
-	   request in the assumption that its tree is not being concurrently altered.
+	   ConcurrentAdd has no effect. Routes may always be added while the router
+	   is serving requests. Requests are served from a snapshot of the routes
+	   which is never altered, but replaced as a whole when routes are added, so
+	   no lock is taken on each request.
+
+	   Deprecated: Serving requests no longer takes a lock.
 	*/
 	ConcurrentAdd bool
 
+	/*
+	   RejectDuplicateRoutes (default false) controls whether or not adding a
+	   route that is already defined is an error. If false, the handler of the
+	   route is replaced. If true, a *RouteError wrapping ErrDuplicateRoute is
+	   returned and the route is left as is; use Replace to replace its handler.
+	*/
+	RejectDuplicateRoutes bool
+
+	/*
+	   PanicOnError (default false) controls whether or not adding routes
+	   panics instead of returning an error if a route cannot be added. It may
+	   be set using Must. Removing and replacing routes is not affected.
+	*/
+	PanicOnError bool
+
 	/*
 	   RedirectTrailingSlash (default true) controls whether or not redirection
 	   occurs if a request is made to a route that matches it except for the
@@ -56,40 +80,196 @@ type Mux struct {
 	   occurs.
 	*/
 	RedirectTrailingSlash bool
-}
 
-// PathParams extracts path params from given context
-func PathParams(ctx context.Context) map[string]string {
-	pathParams, ok := ctx.Value(pathParamsKey).(map[string]string)
-	if ok {
-		return pathParams
-	}
-	return nil
+	/*
+	   RedirectCleanPath (default false) controls whether or not redirection
+	   occurs if a request is made to a path that is not clean, such as
+	   /foo//bar, /foo/./bar or /foo/../bar, but that matches a route once
+	   cleaned. The path is cleaned like path.Clean does, except that a trailing
+	   slash is kept. If true, a request to /foo//bar is redirected to /foo/bar
+	   if /foo/bar is defined. Trailing slash redirection applies to the cleaned
+	   path if RedirectTrailingSlash is true.
+	*/
+	RedirectCleanPath bool
+
+	/*
+	   RedirectCaseInsensitive (default false) controls whether or not
+	   redirection occurs if a request is made to a path that matches a route
+	   only if the case of its static segments is disregarded. If true and
+	   /users/:id is defined, a request to /Users/Foo is redirected to
+	   /users/Foo. Path param values keep their case.
+	*/
+	RedirectCaseInsensitive bool
+
+	/*
+	   RedirectCodes (default GET: 301) maps request methods to the status
+	   codes used when redirecting requests of those methods. Requests of
+	   methods not in the map are redirected using RedirectCode.
+	*/
+	RedirectCodes map[string]int
+
+	/*
+	   RedirectCode (default 307) is the status code used when redirecting
+	   requests of methods not in RedirectCodes.
+	*/
+	RedirectCode int
+
+	/*
+	   RedirectHandler (default nil) is called to respond to requests that are
+	   to be redirected, with the URL to redirect to and the status code given
+	   by RedirectCodes and RedirectCode. It may for instance log the redirect,
+	   or alter the URL or code before calling http.Redirect. If nil,
+	   http.Redirect is called directly.
+	*/
+	RedirectHandler func(ctx context.Context, w http.ResponseWriter, r *http.Request, url string, code int)
+
+	/*
+	   HandleMethodNotAllowed (default true) controls whether or not a request
+	   made to a path that is only defined for other methods is responded to with
+	   405 Method Not Allowed. If true and GET /foo and PUT /foo are defined, a
+	   POST to /foo is responded to with 405 and an Allow header of "GET, PUT".
+	   If false, such requests are responded to with 404 Not Found.
+	*/
+	HandleMethodNotAllowed bool
+
+	/*
+	   HandleOptions (default true) controls whether or not OPTIONS requests are
+	   responded to automatically for paths that are defined for some method but
+	   have no OPTIONS route of their own. The automatic response carries an
+	   Allow header listing the methods defined for the path. If OPTIONS is
+	   defined for the path, its handler is used instead.
+	*/
+	HandleOptions bool
+
+	/*
+	   OptionsHandler (default nil) is called to respond to automatic OPTIONS
+	   requests. The Allow header is set before it is called. If nil, the
+	   automatic response is an empty 200 OK.
+	*/
+	OptionsHandler Handler
+
+	/*
+	   HeadFallback (default true) controls whether or not HEAD requests fall
+	   back to the GET route of the requested path if no HEAD route is defined
+	   for it. The GET handler is then called with a response writer that
+	   discards the body but keeps the headers, including Content-Length.
+	*/
+	HeadFallback bool
+
+	/*
+	   NotFound (default nil) is called to respond to requests for which no
+	   route is defined, including routes defined with a nil handler. If nil,
+	   http.NotFound is used.
+	*/
+	NotFound Handler
 }
 
-type node struct {
-	nodes     map[string]*node
-	pathParam struct {
-		name string
-		node *node
-	}
-	handler Handler
+// routes is a snapshot of the routes trees, mounts and middleware of a mux. A
+// snapshot is never altered once stored in the mux. Changes are made to a copy
+// which then replaces it.
+type routes struct {
+	trees      map[string]*node
+	mounts     []*mount
+	middleware []Middleware
+	handler    Handler
 }
 
-func newNode() *node {
-	return &node{
-		nodes: make(map[string]*node),
-	}
+// Must sets PanicOnError of the mux and returns the mux, so that routes
+// defined by mistake are caught at startup:
+//
+//	mux := moku.New().Must()
+func (m *Mux) Must() *Mux {
+	m.PanicOnError = true
+	return m
 }
 
 // New creates a new Mux with default configuration.
 func New() *Mux {
-	return &Mux{
-		rootNode: newNode(),
+	m := &Mux{
+		ConcurrentAdd:          true,
+		RedirectTrailingSlash:  true,
+		RedirectCodes:          map[string]int{"GET": http.StatusMovedPermanently},
+		RedirectCode:           http.StatusTemporaryRedirect,
+		HandleMethodNotAllowed: true,
+		HandleOptions:          true,
+		HeadFallback:           true,
+	}
+	m.snapshot.Store(&routes{trees: make(map[string]*node)})
+	return m
+}
+
+// load returns the current routes snapshot of the mux.
+func (m *Mux) load() *routes {
+	return m.snapshot.Load().(*routes)
+}
 
-		ConcurrentAdd:         true,
-		RedirectTrailingSlash: true,
+// update calls f with a copy of the current routes snapshot and stores the
+// copy as the new snapshot unless f returns an error. The trees of the copy
+// are shared with the current snapshot and must be cloned before altered.
+func (m *Mux) update(f func(*routes) error) error {
+	m.Lock()
+	defer m.Unlock()
+	current := m.load()
+	r := &routes{
+		trees:      make(map[string]*node, len(current.trees)+1),
+		mounts:     current.mounts,
+		middleware: current.middleware,
+		handler:    current.handler,
+	}
+	for method, root := range current.trees {
+		r.trees[method] = root
+	}
+	if err := f(r); err != nil {
+		return err
 	}
+	m.snapshot.Store(r)
+	return nil
+}
+
+// Handle configures a route of given method, which may be any valid HTTP
+// method, such as PROPFIND or PURGE.
+func (m *Mux) Handle(method string, path string, handler Handler) error {
+	return m.addRoute(method, path, handler)
+}
+
+// HandleFunc configures a route of given method.
+func (m *Mux) HandleFunc(method string, path string, handler HandlerFunc) error {
+	return m.Handle(method, path, handler)
+}
+
+// anyMethods are the methods of the routes configured by Any.
+var anyMethods = []string{
+	"CONNECT",
+	"DELETE",
+	"GET",
+	"HEAD",
+	"OPTIONS",
+	"PATCH",
+	"POST",
+	"PUT",
+	"TRACE",
+}
+
+// Any configures routes of all standard methods (CONNECT, DELETE, GET, HEAD,
+// OPTIONS, PATCH, POST, PUT and TRACE). Either all of them are configured or,
+// if there is an error, none. Since HEAD and OPTIONS are configured, HEAD
+// requests do not fall back to GET and OPTIONS requests are not responded to
+// automatically.
+func (m *Mux) Any(path string, handler Handler) error {
+	handler = nilIfNilFunc(handler)
+	return m.addRoutes(func(r *routes) error {
+		for _, method := range anyMethods {
+			if err := r.addRoute(method, path, handler, !m.RejectDuplicateRoutes); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AnyFunc configures routes of all standard methods.
+func (m *Mux) AnyFunc(path string, handler HandlerFunc) error {
+	return m.Any(path, handler)
 }
 
 // Delete configures a DELETE route.
@@ -172,77 +352,237 @@ func (m *Mux) TraceFunc(path string, handler HandlerFunc) error {
 	return m.Trace(path, handler)
 }
 
-var errNoLeadingSlash = errors.New("Path does not being with leading slash")
-
 func (m *Mux) addRoute(method string, path string, handler Handler) error {
-	if m.ConcurrentAdd {
-		m.Lock()
-		defer m.Unlock()
+	handler = nilIfNilFunc(handler)
+	return m.addRoutes(func(r *routes) error {
+		return r.addRoute(method, path, handler, !m.RejectDuplicateRoutes)
+	})
+}
+
+// addRoutes updates the routes snapshot using f, which adds routes to it. It
+// panics instead of returning an error if PanicOnError is true.
+func (m *Mux) addRoutes(f func(*routes) error) error {
+	err := m.update(f)
+	if err != nil && m.PanicOnError {
+		panic(err)
+	}
+	return err
+}
+
+// Route is a route to be added using Routes.
+type Route struct {
+	Method  string
+	Path    string
+	Handler Handler
+}
+
+// Routes adds the given routes all at once. If any of them cannot be added,
+// none are, and the returned RouteErrors lists the errors of all routes that
+// could not be added.
+func (m *Mux) Routes(rs []Route) error {
+	return m.addRoutes(func(r *routes) error {
+		var errs RouteErrors
+		for _, route := range rs {
+			err := r.addRoute(route.Method, route.Path, nilIfNilFunc(route.Handler), !m.RejectDuplicateRoutes)
+			if err != nil {
+				errs = append(errs, err.(*RouteError))
+			}
+		}
+		if errs != nil {
+			return errs
+		}
+		return nil
+	})
+}
+
+// addRoute adds a route to r, cloning the nodes of its tree on the way to the
+// route. If the route is already defined its handler is replaced if replace is
+// true, and ErrDuplicateRoute is returned otherwise.
+func (r *routes) addRoute(method string, path string, handler Handler, replace bool) error {
+	if err := checkRoute(method, path); err != nil {
+		return err
+	}
+	routeError := func(segment int, err error) error {
+		return &RouteError{Method: method, Path: path, Segment: segment, Err: err}
 	}
-	if path[0] != '/' {
-		return errNoLeadingSlash
+	if i := strings.Index(path, "/*"); i >= 0 && strings.Contains(path[i+1:], "/") {
+		return routeError(strings.Count(path[:i+1], "/")-1, ErrCatchAllNotLast)
 	}
 
-	currentNode, ok := m.rootNode.nodes[method]
-	if !ok {
-		currentNode = newNode()
-		m.rootNode.nodes[method] = currentNode
+	currentNode := &node{}
+	if root, ok := r.trees[method]; ok {
+		currentNode = root.clone()
 	}
+	r.trees[method] = currentNode
+	var paramNames, paramParts []string
+	var paramSegments []int
+	staticStart, offset, segment := 1, 1, -1
 	err := splitString(path[1:], "/", func(part string) error {
-		if len(part) > 0 && part[0] == ':' {
-			if currentNode.pathParam.node == nil {
-				currentNode.pathParam.name = part[1:]
-				currentNode.pathParam.node = newNode()
-			} else {
-				if currentNode.pathParam.name != part[1:] {
-					return fmt.Errorf(
-						"Path param ':%s' of '%s' already defined as ':%s'",
-						part,
-						path,
-						currentNode.pathParam.name,
-					)
-				}
+		start := offset
+		offset += len(part) + 1
+		segment++
+		if len(part) == 0 || part[0] != ':' && part[0] != '*' {
+			return nil
+		}
+		if len(part) == 1 {
+			return routeError(segment, ErrEmptyParamName)
+		}
+		currentNode = currentNode.addStatic(path[staticStart:start])
+		staticStart = start + len(part)
+		paramNames = append(paramNames, part[1:])
+		paramParts = append(paramParts, part)
+		paramSegments = append(paramSegments, segment)
+		if part[0] == ':' {
+			name, pattern, err := splitConstraint(part[1:])
+			if err != nil {
+				return routeError(segment, err)
+			}
+			node, err := currentNode.addPathParam(name, pattern)
+			if err != nil {
+				return routeError(segment, err)
 			}
-			currentNode = currentNode.pathParam.node
+			paramNames[len(paramNames)-1] = name
+			currentNode = node
 			return nil
 		}
-		t := currentNode.nodes
-		child, ok := t[part]
-		if !ok {
-			child = newNode()
-			t[part] = child
+		if currentNode.catchAll.node == nil {
+			currentNode.catchAll.name = part[1:]
+			currentNode.catchAll.node = &node{}
+		} else if currentNode.catchAll.name != part[1:] {
+			return routeError(segment, fmt.Errorf("%w: '%s' as '*%s'", ErrPathParamConflict, part, currentNode.catchAll.name))
+		} else {
+			currentNode.catchAll.node = currentNode.catchAll.node.clone()
 		}
-		currentNode = child
+		currentNode = currentNode.catchAll.node
 		return nil
 	})
 	if err != nil {
 		return err
 	}
+	currentNode = currentNode.addStatic(path[staticStart:])
+	if currentNode.defined {
+		for n, name := range currentNode.paramNames {
+			if name != paramNames[n] {
+				err := fmt.Errorf("%w: '%s' as '%c%s'", ErrPathParamConflict, paramParts[n], paramParts[n][0], name)
+				return routeError(paramSegments[n], err)
+			}
+		}
+		if !replace {
+			return routeError(-1, ErrDuplicateRoute)
+		}
+	}
 	currentNode.handler = handler
+	currentNode.defined = true
+	currentNode.paramNames = paramNames
 	return nil
 }
 
+// Remove removes the route of given method and path. The path is given as
+// defined, path params included. Parts of the routes tree left without routes
+// are removed with it.
+func (m *Mux) Remove(method string, path string) error {
+	return m.updateRoute(method, path, func(n *node) {
+		n.handler = nil
+		n.defined = false
+		n.paramNames = nil
+	})
+}
+
+// Replace replaces the handler of the route of given method and path. The path
+// is given as defined, path params included.
+func (m *Mux) Replace(method string, path string, handler Handler) error {
+	handler = nilIfNilFunc(handler)
+	return m.updateRoute(method, path, func(n *node) {
+		n.handler = handler
+	})
+}
+
+// ReplaceFunc replaces the handler of the route of given method and path.
+func (m *Mux) ReplaceFunc(method string, path string, handler HandlerFunc) error {
+	return m.Replace(method, path, handler)
+}
+
+// updateRoute calls f with the node of the route of given method and path
+// defined in a copy of the routes tree of the method, which then replaces the
+// tree.
+func (m *Mux) updateRoute(method string, path string, f func(*node)) error {
+	if err := checkRoute(method, path); err != nil {
+		return err
+	}
+	return m.update(func(r *routes) error {
+		root, ok := r.trees[method]
+		if ok {
+			root, ok = root.updateRoute(path[1:], true, nil, f)
+		}
+		if !ok {
+			return &RouteError{Method: method, Path: path, Segment: -1, Err: ErrRouteNotDefined}
+		}
+		if root == nil {
+			delete(r.trees, method)
+		} else {
+			r.trees[method] = root
+		}
+		return nil
+	})
+}
+
+// nilIfNilFunc returns nil if handler is a nil HandlerFunc, so that routes
+// defined with a nil handler are treated as having no handler.
+func nilIfNilFunc(handler Handler) Handler {
+	if f, ok := handler.(HandlerFunc); ok && f == nil {
+		return nil
+	}
+	return handler
+}
+
+// ServeHTTP serves the request with the context of the request, see
+// ServeHTTPC.
 func (m *Mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	m.ServeHTTPC(context.Background(), w, r)
+	m.ServeHTTPC(r.Context(), w, r)
 }
 
-// ServeHTTPC is ServeHTTP with added context
+// ServeHTTPC is ServeHTTP with added context. The path params of the request
+// are stored in a context derived from ctx, which is passed to the handler and
+// attached to the request, so that path params are available using both
+// PathParams(ctx) and PathParams(r.Context()).
+//
+// If ctx already holds path params, as when the mux is served by the handler
+// of another mux, the path params of the mux are added to a copy of them, so
+// that the path params of the other mux are left as they are.
 func (m *Mux) ServeHTTPC(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-	pathParams := PathParams(ctx)
-	if pathParams == nil {
-		pathParams = make(map[string]string)
-		ctx = context.WithValue(ctx, pathParamsKey, pathParams)
+	p := getParams()
+	defer putParams(p)
+	if outer := ParamsFromContext(ctx); outer != nil {
+		p.values = append(p.values, outer.values...)
+	}
+	ctx = context.WithValue(ctx, pathParamsKey, p)
+	if ctx != r.Context() {
+		r = r.WithContext(ctx)
+	}
+	if h := m.load().handler; h == nil {
+		m.route(ctx, w, r)
+	} else {
+		h.ServeHTTPC(ctx, w, r)
 	}
-	h, isRedirect := m.findHandler(r, pathParams)
+}
+
+// route looks up the handler of the request and calls it, or responds with a
+// redirect, 405 Method Not Allowed or 404 Not Found.
+func (m *Mux) route(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	p, _ := ctx.Value(pathParamsKey).(*Params)
+	h, redirectPath := m.findHandler(r, p)
 	if h == nil {
-		if isRedirect {
-			var code int
-			if r.Method == "GET" {
-				code = http.StatusMovedPermanently
-			} else {
-				code = http.StatusTemporaryRedirect
+		if redirectPath != "" {
+			m.redirect(ctx, w, r, redirectPath)
+		} else if r.Method == "OPTIONS" && m.HandleOptions && m.setAllowHeader(w, r) {
+			if m.OptionsHandler != nil {
+				m.OptionsHandler.ServeHTTPC(ctx, w, r)
 			}
-			http.Redirect(w, r, r.URL.String(), code)
+		} else if m.HandleMethodNotAllowed && m.setAllowHeader(w, r) {
+			code := http.StatusMethodNotAllowed
+			http.Error(w, http.StatusText(code), code)
+		} else if m.NotFound != nil {
+			m.NotFound.ServeHTTPC(ctx, w, r)
 		} else {
 			http.NotFound(w, r)
 		}
@@ -251,63 +591,280 @@ func (m *Mux) ServeHTTPC(ctx context.Context, w http.ResponseWriter, r *http.Req
 	}
 }
 
-var errDeadEnd = errors.New("Dead end")
-
-func (m *Mux) findHandler(r *http.Request, pathParams map[string]string) (Handler, bool) {
-	if m.ConcurrentAdd {
-		m.RLock()
-		defer m.RUnlock()
+// redirect redirects the request to given path, keeping the query string. The
+// status code is looked up in RedirectCodes, falling back to RedirectCode. If
+// the mux is mounted, the path is prefixed by the prefix stripped from the
+// request path.
+func (m *Mux) redirect(ctx context.Context, w http.ResponseWriter, r *http.Request, path string) {
+	code, ok := m.RedirectCodes[r.Method]
+	if !ok {
+		code = m.RedirectCode
 	}
-	var node, lastNode *node
-	var ok bool
-	nextNodeCandidates := m.rootNode.nodes
-	node, ok = nextNodeCandidates[r.Method]
-	if ok {
-		nextNodeCandidates = node.nodes
+	u := *r.URL
+	u.Path = MountPrefix(ctx) + path
+	u.RawPath = ""
+	if m.RedirectHandler != nil {
+		m.RedirectHandler(ctx, w, r, u.String(), code)
 	} else {
-		return nil, false
+		http.Redirect(w, r, u.String(), code)
 	}
-	path := r.URL.Path[1:]
-	err := splitString(path, "/", func(part string) error {
-		lastNode = node
-		node, ok = nextNodeCandidates[part]
-		if ok {
-			nextNodeCandidates = node.nodes
-		} else if lastNode.pathParam.node != nil && part != "" {
-			pathParams[lastNode.pathParam.name] = part
-			node = lastNode.pathParam.node
-			nextNodeCandidates = node.nodes
-		} else {
-			return errDeadEnd
+}
+
+// findHandler returns the handler of the request, or if there is none, the
+// path to redirect the request to, if any. Requests without a path, such as
+// CONNECT requests, match no route. Routes and their redirects take
+// precedence over mounts, and paths are cleaned before being matched against
+// mounts, so that mounted handlers are not passed unclean paths.
+func (m *Mux) findHandler(r *http.Request, pathParams *Params) (Handler, string) {
+	path := r.URL.Path
+	if path == "" {
+		// CONNECT requests have no path, only a host
+		return nil, ""
+	}
+	h, redirectPath := m.lookup(r.Method, path, pathParams)
+	if h != nil {
+		return h, ""
+	}
+	if redirectPath != "" {
+		return nil, redirectPath
+	}
+	if m.RedirectCleanPath {
+		if cleanedPath := cleanPath(path); cleanedPath != path {
+			if h, redirectPath = m.lookup(r.Method, cleanedPath, nil); h != nil {
+				return nil, cleanedPath
+			}
+			if redirectPath != "" {
+				return nil, redirectPath
+			}
+			if m.findMount(cleanedPath) != nil {
+				return nil, cleanedPath
+			}
+			path = cleanedPath
 		}
-		return nil
-	})
-	if m.RedirectTrailingSlash && (node == nil || node.handler == nil) {
-		return nil, setRedirectURL(r, node, lastNode)
 	}
-	if err == errDeadEnd {
-		return nil, false
+	if mnt := m.findMount(path); mnt != nil {
+		if path == mnt.prefix && m.RedirectTrailingSlash {
+			return nil, path + "/"
+		}
+		return mnt, ""
 	}
-	return node.handler, false
+	if m.RedirectCaseInsensitive {
+		if fixedPath, ok := m.fixCase(r.Method, path); ok && fixedPath != r.URL.Path {
+			return nil, fixedPath
+		}
+	}
+	return nil, ""
 }
 
-func setRedirectURL(r *http.Request, node, lastNode *node) bool {
-	path := r.URL.Path
-	if path[len(path)-1] == '/' {
-		if lastNode != nil && lastNode.handler != nil {
-			r.URL.Path = path[:len(path)-1]
-			return true
-		}
-	} else {
-		if node != nil {
-			trailingNode, ok := node.nodes[""]
-			if ok && trailingNode.handler != nil {
-				r.URL.Path = path + "/"
-				return true
+// fixCase returns given path with the case of its static parts changed to
+// match a route of given method, or of GET for HEAD requests if HeadFallback is
+// true. Exact matches take precedence over case-insensitive ones. If
+// RedirectTrailingSlash is true, the trailing slash of the path is added or
+// removed if the path matches no route as is. It returns false if the path
+// matches no route.
+func (m *Mux) fixCase(method string, path string) (string, bool) {
+	paths := []string{path}
+	if m.RedirectTrailingSlash && path != "/" {
+		paths = append(paths, toggleTrailingSlash(path))
+	}
+	methods := []string{method}
+	if method == "HEAD" && m.HeadFallback {
+		methods = append(methods, "GET")
+	}
+	trees := m.load().trees
+	for _, p := range paths {
+		for _, method := range methods {
+			root, ok := trees[method]
+			if !ok {
+				continue
+			}
+			if fixed, ok := root.fixCase(p[1:], append(make([]byte, 0, len(p)), '/')); ok {
+				return string(fixed), true
 			}
 		}
 	}
-	return false
+	return "", false
+}
+
+// lookup returns the handler of given method and path, or if there is none,
+// the path to redirect to, if any.
+func (m *Mux) lookup(method string, path string, pathParams *Params) (Handler, string) {
+	if h := m.match(method, path, pathParams); h != nil {
+		return h, ""
+	}
+	headFallback := method == "HEAD" && m.HeadFallback
+	if headFallback {
+		if h := m.match("GET", path, pathParams); h != nil {
+			return headHandler{h}, ""
+		}
+	}
+	if m.RedirectTrailingSlash {
+		if redirectPath, ok := m.trailingSlashRedirect(method, path); ok {
+			return nil, redirectPath
+		}
+		if headFallback {
+			redirectPath, _ := m.trailingSlashRedirect("GET", path)
+			return nil, redirectPath
+		}
+	}
+	return nil, ""
+}
+
+// cleanPath cleans given path like path.Clean does, except that a trailing
+// slash is kept.
+func cleanPath(p string) string {
+	cleaned := pathpkg.Clean(p)
+	if p[len(p)-1] == '/' && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// setAllowHeader sets the Allow header of the response to the methods defined
+// for the requested path and returns true, or returns false without setting the
+// header if no method is defined for the path.
+func (m *Mux) setAllowHeader(w http.ResponseWriter, r *http.Request) bool {
+	allowed := m.allowedMethods(r.URL.Path)
+	if len(allowed) == 0 {
+		return false
+	}
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	return true
+}
+
+// allowedMethods returns the sorted list of methods for which a handler is
+// defined at given path. OPTIONS is included if HandleOptions is true.
+func (m *Mux) allowedMethods(path string) []string {
+	if path == "" {
+		return nil
+	}
+	var allowed []string
+	defined := make(map[string]bool)
+	for method := range m.load().trees {
+		if m.match(method, path, nil) != nil {
+			allowed = append(allowed, method)
+			defined[method] = true
+		}
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	if m.HeadFallback && defined["GET"] && !defined["HEAD"] {
+		allowed = append(allowed, "HEAD")
+	}
+	if m.HandleOptions && !defined["OPTIONS"] {
+		allowed = append(allowed, "OPTIONS")
+	}
+	sort.Strings(allowed)
+	return allowed
+}
+
+// match returns the handler of the route of given method matching given path,
+// or nil if there is none. The path params of the route are appended to
+// pathParams unless it is nil.
+func (m *Mux) match(method string, path string, pathParams *Params) Handler {
+	root, ok := m.load().trees[method]
+	if !ok {
+		return nil
+	}
+	var values []paramValue
+	if pathParams != nil {
+		values = pathParams.values
+	}
+	base := len(values)
+	node, values := root.match(path[1:], values)
+	if node == nil {
+		return nil
+	}
+	if pathParams != nil {
+		for n, name := range node.paramNames {
+			values[base+n].name = name
+		}
+		pathParams.values = values
+	}
+	return node.handler
+}
+
+// headHandler calls its handler with a response writer that discards the
+// response body, for serving HEAD requests using GET handlers.
+type headHandler struct {
+	handler Handler
+}
+
+func (h headHandler) ServeHTTPC(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	hw := &headResponseWriter{ResponseWriter: w}
+	h.handler.ServeHTTPC(ctx, hw, r)
+	hw.flushHeader()
+}
+
+// headResponseWriter discards the response body while keeping track of its
+// length. Writing the header is deferred until the handler returns so that
+// Content-Length can be set from the length of the discarded body.
+type headResponseWriter struct {
+	http.ResponseWriter
+	code   int
+	length int
+}
+
+func (w *headResponseWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *headResponseWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	header := w.Header()
+	if w.length == 0 && header.Get("Content-Type") == "" && len(b) > 0 {
+		header.Set("Content-Type", http.DetectContentType(b))
+	}
+	w.length += len(b)
+	return len(b), nil
+}
+
+// Flush does nothing, since the header is written once the handler returns
+// and there is no body to flush. It keeps handlers that flush working.
+func (w *headResponseWriter) Flush() {}
+
+// Unwrap returns the underlying response writer, for http.ResponseController.
+func (w *headResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *headResponseWriter) flushHeader() {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	header := w.Header()
+	if w.length > 0 && header.Get("Content-Length") == "" && header.Get("Transfer-Encoding") == "" {
+		header.Set("Content-Length", strconv.Itoa(w.length))
+	}
+	w.ResponseWriter.WriteHeader(w.code)
+}
+
+// trailingSlashRedirect returns the path to redirect to if path does not match
+// a route of given method but would if its trailing slash were added or
+// removed.
+func (m *Mux) trailingSlashRedirect(method string, path string) (string, bool) {
+	if path == "/" {
+		return "", false
+	}
+	redirectPath := toggleTrailingSlash(path)
+	if m.match(method, redirectPath, nil) == nil {
+		return "", false
+	}
+	return redirectPath, true
+}
+
+// toggleTrailingSlash removes the trailing slash of path if it has one, and
+// adds one otherwise.
+func toggleTrailingSlash(path string) string {
+	if path[len(path)-1] == '/' {
+		return path[:len(path)-1]
+	}
+	return path + "/"
 }
 
 func splitString(s string, delimiter string, callback func(string) error) error {
@@ -334,28 +891,37 @@ func (m *Mux) PrintRoutes() {
 	}
 	var item *pathItem
 	var stack []*pathItem
-	for name, node := range m.rootNode.nodes {
-		stack = append(stack, &pathItem{name, node, 0})
-	}
-	if m.rootNode.pathParam.node != nil {
-		name := ":" + m.rootNode.pathParam.name
-		node := m.rootNode.pathParam.node
-		stack = append(stack, &pathItem{name, node, 0})
-	}
-	for len(stack) > 0 {
-		item, stack = stack[len(stack)-1], stack[:len(stack)-1]
-		hasHandlerStr := "  "
-		if item.node.handler != nil {
-			hasHandlerStr = "* "
-		}
-		fmt.Printf("%s%s%s\n", hasHandlerStr, strings.Repeat("  ", item.indent), item.name)
-		for name, node := range item.node.nodes {
-			stack = append(stack, &pathItem{"/" + name, node, item.indent + 1})
-		}
-		if item.node.pathParam.node != nil {
-			name := ":" + item.node.pathParam.name
-			node := item.node.pathParam.node
-			stack = append(stack, &pathItem{"/" + name, node, item.indent + 1})
+	r := m.load()
+	for _, mnt := range r.mounts {
+		fmt.Printf("  MOUNT %s/\n", mnt.prefix)
+	}
+	for method, root := range r.trees {
+		fmt.Printf("  %s\n", method)
+		stack = append(stack, &pathItem{"/", root, 1})
+		for len(stack) > 0 {
+			item, stack = stack[len(stack)-1], stack[:len(stack)-1]
+			hasHandlerStr := "  "
+			if item.node.handler != nil {
+				hasHandlerStr = "* "
+			}
+			fmt.Printf("%s%s%s\n", hasHandlerStr, strings.Repeat("  ", item.indent), item.name)
+			indent := item.indent + 1
+			if item.node.catchAll.node != nil {
+				name := "*" + item.node.catchAll.name
+				stack = append(stack, &pathItem{name, item.node.catchAll.node, indent})
+			}
+			for n := len(item.node.pathParams) - 1; n >= 0; n-- {
+				p := item.node.pathParams[n]
+				name := ":" + strings.Join(p.names, "|")
+				if p.constraint != nil {
+					name += "<" + p.constraint.String() + ">"
+				}
+				stack = append(stack, &pathItem{name, p.node, indent})
+			}
+			for n := len(item.node.children) - 1; n >= 0; n-- {
+				child := item.node.children[n]
+				stack = append(stack, &pathItem{child.prefix, child, indent})
+			}
 		}
 	}
 }
@@ -1,14 +1,19 @@
 package moku
 
 import (
+	"bufio"
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 
-	"golang.org/x/net/context"
+	xcontext "golang.org/x/net/context"
 )
 
 func assertStatus(t *testing.T, mux *Mux, method string, path string, status int) {
@@ -61,8 +66,8 @@ func TestGetFuncWithoutLeadingSlash(t *testing.T) {
 	mux := New()
 	path := "foo"
 	err := mux.GetFunc(path, func(ctx context.Context, w http.ResponseWriter, r *http.Request) {})
-	if err != errNoLeadingSlash {
-		t.Errorf("Expected errNoLeadingSlash, got %s", err)
+	if !errors.Is(err, ErrNoLeadingSlash) {
+		t.Errorf("Expected ErrNoLeadingSlash, got %s", err)
 	}
 	assertStatus(t, mux, "GET", path, http.StatusNotFound)
 }
@@ -244,6 +249,26 @@ func TestMuxStaticNotFound(t *testing.T) {
 	assertStatus(t, mux, "GET", "/undefined", http.StatusNotFound)
 }
 
+func TestMuxCustomNotFound(t *testing.T) {
+	mux := New()
+	mux.NotFound = HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"error":"not found"}`)
+	})
+	mux.GetFunc("/nilhandler", nil)
+	group := mux.Group("/group")
+	group.Use(writeMiddleware("mw,"))
+	group.GetFunc("/nilhandler", nil)
+	mux.PostFunc("/post", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {})
+
+	for _, path := range []string{"/undefined", "/nilhandler", "/nilhandler/", "/group/nilhandler"} {
+		assertStatus(t, mux, "GET", path, http.StatusNotFound)
+		assertBodyEquals(t, mux, "GET", path, `{"error":"not found"}`)
+	}
+	assertStatus(t, mux, "HEAD", "/nilhandler", http.StatusNotFound)
+	assertStatus(t, mux, "GET", "/post", http.StatusMethodNotAllowed)
+}
+
 func TestMuxStaticRedirectTrailingSlashGet(t *testing.T) {
 	mux := newMuxWithGetPaths([]string{
 		"/",
@@ -324,6 +349,241 @@ func TestMuxStaticRedirectTrailingSlashPost(t *testing.T) {
 	}
 }
 
+func TestMuxMethodNotAllowed(t *testing.T) {
+	mux := New()
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {}
+	mux.GetFunc("/foo", handler)
+	mux.PutFunc("/foo", handler)
+	mux.PostFunc("/bar/:id", handler)
+	mux.DeleteFunc("/baz/", handler)
+
+	expectations := []struct {
+		method        string
+		requestedPath string
+		expectedAllow string
+		expectedCode  int
+	}{
+		{"GET", "/foo", "", http.StatusOK},
+		{"POST", "/foo", "GET, HEAD, OPTIONS, PUT", http.StatusMethodNotAllowed},
+		{"DELETE", "/foo", "GET, HEAD, OPTIONS, PUT", http.StatusMethodNotAllowed},
+		{"GET", "/bar/5", "OPTIONS, POST", http.StatusMethodNotAllowed},
+		{"GET", "/bar/", "", http.StatusNotFound},
+		{"GET", "/baz/", "DELETE, OPTIONS", http.StatusMethodNotAllowed},
+		{"GET", "/baz", "", http.StatusNotFound},
+		{"GET", "/undefined", "", http.StatusNotFound},
+	}
+	for _, e := range expectations {
+		assertStatus(t, mux, e.method, e.requestedPath, e.expectedCode)
+		assertHeader(t, mux, e.method, e.requestedPath, "Allow", e.expectedAllow)
+	}
+
+	mux.HandleMethodNotAllowed = false
+	assertStatus(t, mux, "POST", "/foo", http.StatusNotFound)
+	assertHeader(t, mux, "POST", "/foo", "Allow", "")
+}
+
+func TestMuxAutomaticOptions(t *testing.T) {
+	mux := New()
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {}
+	mux.GetFunc("/foo", handler)
+	mux.PutFunc("/foo", handler)
+	mux.PostFunc("/bar/:id", handler)
+	mux.OptionsFunc("/baz", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "explicit")
+	})
+	mux.GetFunc("/baz", handler)
+
+	expectations := []struct {
+		requestedPath string
+		expectedAllow string
+		expectedCode  int
+	}{
+		{"/foo", "GET, HEAD, OPTIONS, PUT", http.StatusOK},
+		{"/bar/5", "OPTIONS, POST", http.StatusOK},
+		{"/baz", "", http.StatusOK},
+		{"/undefined", "", http.StatusNotFound},
+	}
+	for _, e := range expectations {
+		assertStatus(t, mux, "OPTIONS", e.requestedPath, e.expectedCode)
+		assertHeader(t, mux, "OPTIONS", e.requestedPath, "Allow", e.expectedAllow)
+	}
+	assertBodyEquals(t, mux, "OPTIONS", "/baz", "explicit")
+	assertHeader(t, mux, "POST", "/baz", "Allow", "GET, HEAD, OPTIONS")
+
+	mux.OptionsHandler = HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, w.Header().Get("Allow"))
+	})
+	assertBodyEquals(t, mux, "OPTIONS", "/foo", "GET, HEAD, OPTIONS, PUT")
+
+	mux.HandleOptions = false
+	assertStatus(t, mux, "OPTIONS", "/foo", http.StatusMethodNotAllowed)
+	assertHeader(t, mux, "OPTIONS", "/foo", "Allow", "GET, HEAD, PUT")
+}
+
+func TestMuxHeadFallback(t *testing.T) {
+	mux := New()
+	mux.GetFunc("/foo", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Foo", "foo")
+		io.WriteString(w, "<html>hello</html>")
+	})
+	mux.GetFunc("/bar/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	mux.HeadFunc("/baz", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Baz", "head")
+	})
+	mux.GetFunc("/baz", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Baz", "get")
+	})
+
+	assertStatus(t, mux, "HEAD", "/foo", http.StatusOK)
+	assertBodyEquals(t, mux, "HEAD", "/foo", "")
+	assertHeader(t, mux, "HEAD", "/foo", "X-Foo", "foo")
+	assertHeader(t, mux, "HEAD", "/foo", "Content-Length", "18")
+	assertHeader(t, mux, "HEAD", "/foo", "Content-Type", "text/html; charset=utf-8")
+	assertStatus(t, mux, "HEAD", "/bar/", http.StatusAccepted)
+	assertHeader(t, mux, "HEAD", "/bar/", "Content-Length", "")
+	assertStatus(t, mux, "HEAD", "/bar", http.StatusTemporaryRedirect)
+	assertHeader(t, mux, "HEAD", "/bar", "Location", "/bar/")
+	assertHeader(t, mux, "HEAD", "/baz", "X-Baz", "head")
+	assertHeader(t, mux, "OPTIONS", "/foo", "Allow", "GET, HEAD, OPTIONS")
+
+	mux.GetFunc("/flush", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Flush", "flush")
+		io.WriteString(w, "hello")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, " world")
+		if _, ok := w.(interface{ Unwrap() http.ResponseWriter }); !ok {
+			t.Error("Expected response writer to have Unwrap")
+		}
+	})
+	assertStatus(t, mux, "HEAD", "/flush", http.StatusOK)
+	assertBodyEquals(t, mux, "HEAD", "/flush", "")
+	assertHeader(t, mux, "HEAD", "/flush", "X-Flush", "flush")
+	assertHeader(t, mux, "HEAD", "/flush", "Content-Length", "11")
+
+	mux.HeadFallback = false
+	assertStatus(t, mux, "HEAD", "/foo", http.StatusMethodNotAllowed)
+	assertHeader(t, mux, "HEAD", "/foo", "Allow", "GET, OPTIONS")
+}
+
+func TestMuxRedirectTrailingSlashDeadEnd(t *testing.T) {
+	mux := newMuxWithGetPaths([]string{"/foo"})
+	assertStatus(t, mux, "GET", "/foo/bar/", http.StatusNotFound)
+	assertHeader(t, mux, "GET", "/foo/bar/", "Location", "")
+}
+
+func TestMuxRedirectCodes(t *testing.T) {
+	mux := newMuxWithGetPaths([]string{"/foo"})
+	mux.PostFunc("/foo", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {})
+	mux.PutFunc("/foo", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {})
+	mux.RedirectCodes = map[string]int{
+		"GET": http.StatusFound,
+		"PUT": http.StatusTemporaryRedirect,
+	}
+	mux.RedirectCode = http.StatusPermanentRedirect
+
+	assertStatus(t, mux, "GET", "/foo/", http.StatusFound)
+	assertStatus(t, mux, "PUT", "/foo/", http.StatusTemporaryRedirect)
+	assertStatus(t, mux, "POST", "/foo/", http.StatusPermanentRedirect)
+	assertHeader(t, mux, "POST", "/foo/", "Location", "/foo")
+}
+
+func TestMuxRedirectHandler(t *testing.T) {
+	mux := newMuxWithGetPaths([]string{"/foo/"})
+	var gotPath, gotURL string
+	var gotCode int
+	mux.RedirectHandler = func(ctx context.Context, w http.ResponseWriter, r *http.Request, url string, code int) {
+		gotPath, gotURL, gotCode = r.URL.Path, url, code
+		http.Redirect(w, r, url, http.StatusFound)
+	}
+
+	assertStatus(t, mux, "GET", "/foo?a=b", http.StatusFound)
+	if gotPath != "/foo" {
+		t.Errorf("Expected request path \"/foo\", got %q", gotPath)
+	}
+	if gotURL != "/foo/?a=b" {
+		t.Errorf("Expected redirect URL \"/foo/?a=b\", got %q", gotURL)
+	}
+	if gotCode != http.StatusMovedPermanently {
+		t.Errorf("Expected redirect code %d, got %d", http.StatusMovedPermanently, gotCode)
+	}
+}
+
+func TestMuxRedirectCleanPath(t *testing.T) {
+	mux := newMuxWithGetPaths([]string{
+		"/",
+		"/foo/bar",
+		"/baz/",
+		"/a/:id",
+	})
+	mux.RedirectCleanPath = true
+
+	expectations := []struct {
+		requestedPath        string
+		expectedRedirectPath string
+		expectedCode         int
+	}{
+		{"/foo/bar", "", http.StatusOK},
+		{"/foo//bar", "/foo/bar", http.StatusMovedPermanently},
+		{"/foo/./bar", "/foo/bar", http.StatusMovedPermanently},
+		{"/foo/../foo/bar", "/foo/bar", http.StatusMovedPermanently},
+		{"/foo//bar/", "/foo/bar", http.StatusMovedPermanently},
+		{"/baz//", "/baz/", http.StatusMovedPermanently},
+		{"/baz/.", "/baz/", http.StatusMovedPermanently},
+		{"/a//5", "/a/5", http.StatusMovedPermanently},
+		{"/foo/..", "/", http.StatusMovedPermanently},
+		{"/x/../undefined", "", http.StatusNotFound},
+	}
+	for _, e := range expectations {
+		assertStatus(t, mux, "GET", e.requestedPath, e.expectedCode)
+		assertHeader(t, mux, "GET", e.requestedPath, "Location", e.expectedRedirectPath)
+	}
+
+	mux.RedirectCleanPath = false
+	assertStatus(t, mux, "GET", "/foo//bar", http.StatusNotFound)
+}
+
+func TestMuxRedirectCaseInsensitive(t *testing.T) {
+	mux := newMuxWithGetPaths([]string{
+		"/users/:id",
+		"/Foo/Bar",
+		"/foo/baz/",
+		"/static/*filepath",
+		"/a/b",
+		"/A/c",
+	})
+	mux.RedirectCaseInsensitive = true
+	mux.RedirectCleanPath = true
+
+	expectations := []struct {
+		requestedPath        string
+		expectedRedirectPath string
+		expectedCode         int
+	}{
+		{"/users/Foo", "", http.StatusOK},
+		{"/Users/Foo", "/users/Foo", http.StatusMovedPermanently},
+		{"/USERS/42", "/users/42", http.StatusMovedPermanently},
+		{"/foo/bar", "/Foo/Bar", http.StatusMovedPermanently},
+		{"/FOO/BAZ/", "/foo/baz/", http.StatusMovedPermanently},
+		{"/FOO/BAZ", "/foo/baz/", http.StatusMovedPermanently},
+		{"/Static/Foo/Bar.js", "/static/Foo/Bar.js", http.StatusMovedPermanently},
+		{"/a/C", "/A/c", http.StatusMovedPermanently},
+		{"/FOO/BAR/", "/Foo/Bar", http.StatusMovedPermanently},
+		{"/./USERS/42", "/users/42", http.StatusMovedPermanently},
+		{"/undefined", "", http.StatusNotFound},
+	}
+	for _, e := range expectations {
+		assertStatus(t, mux, "GET", e.requestedPath, e.expectedCode)
+		assertHeader(t, mux, "GET", e.requestedPath, "Location", e.expectedRedirectPath)
+	}
+	assertStatus(t, mux, "HEAD", "/Users/Foo", http.StatusTemporaryRedirect)
+	assertHeader(t, mux, "HEAD", "/Users/Foo", "Location", "/users/Foo")
+
+	mux.RedirectCaseInsensitive = false
+	assertStatus(t, mux, "GET", "/Users/Foo", http.StatusNotFound)
+}
+
 func TestMuxPathParams(t *testing.T) {
 	expectations := []struct {
 		definedPath        string
@@ -340,6 +600,72 @@ func TestMuxPathParams(t *testing.T) {
 	}
 }
 
+func TestMuxCatchAll(t *testing.T) {
+	mux := newMuxWithGetPaths([]string{
+		"/static/*filepath",
+		"/static/css/main.css",
+		"/static/:dir/index.html",
+		"/files/",
+	})
+	mux.GetFunc("/files/*rest", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "rest="+PathParams(ctx)["rest"])
+	})
+
+	expectations := []struct {
+		requestedPath string
+		expectedBody  string
+		expectedCode  int
+	}{
+		{"/static/foo", "/static/*filepath", http.StatusOK},
+		{"/static/foo/bar.js", "/static/*filepath", http.StatusOK},
+		{"/static/css/main.css", "/static/css/main.css", http.StatusOK},
+		{"/static/css/other.css", "/static/*filepath", http.StatusOK},
+		{"/static/js/index.html", "/static/:dir/index.html", http.StatusOK},
+		{"/static/js/index.htm", "/static/*filepath", http.StatusOK},
+		{"/static/", "", http.StatusNotFound},
+		{"/files/", "/files/", http.StatusOK},
+		{"/files/a/b/", "rest=a/b/", http.StatusOK},
+		{"/files/a//b", "rest=a//b", http.StatusOK},
+	}
+	for _, e := range expectations {
+		assertStatus(t, mux, "GET", e.requestedPath, e.expectedCode)
+		if e.expectedCode == http.StatusOK {
+			assertBodyEquals(t, mux, "GET", e.requestedPath, e.expectedBody)
+		}
+	}
+
+	assertPathParams(t, New(), "GET", "/foo/:id/*rest", "/foo/1/bar/baz", map[string]string{"id": "1", "rest": "bar/baz"})
+	assertPathParams(t, New(), "GET", "/*path", "/foo/bar", map[string]string{"path": "foo/bar"})
+}
+
+func TestCatchAllNotLast(t *testing.T) {
+	mux := New()
+	err := mux.GetFunc("/foo/*rest/bar", nil)
+	if !errors.Is(err, ErrCatchAllNotLast) {
+		t.Errorf("Expected ErrCatchAllNotLast, got %v", err)
+	}
+}
+
+func TestEmptyPathParamName(t *testing.T) {
+	mux := New()
+	for _, path := range []string{"/x/*", "/x/:", "/:/x"} {
+		err := mux.GetFunc(path, func(ctx context.Context, w http.ResponseWriter, r *http.Request) {})
+		if !errors.Is(err, ErrEmptyParamName) {
+			t.Errorf("Expected ErrEmptyParamName adding %s, got %v", path, err)
+		}
+	}
+	assertStatus(t, mux, "GET", "/x/y", http.StatusNotFound)
+}
+
+func TestDuplicateCatchAll(t *testing.T) {
+	mux := New()
+	mux.GetFunc("/foo/*bar", nil)
+	err := mux.GetFunc("/foo/*baz", nil)
+	if !errors.Is(err, ErrPathParamConflict) {
+		t.Errorf("Expected ErrPathParamConflict, got %v", err)
+	}
+}
+
 func TestDuplicatePathParam(t *testing.T) {
 	mux := New()
 	mux.GetFunc("/:foo", nil)
@@ -349,6 +675,561 @@ func TestDuplicatePathParam(t *testing.T) {
 	}
 }
 
+func TestMuxDifferentlyNamedPathParams(t *testing.T) {
+	mux := New()
+	writeParams := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		pathParams := PathParams(ctx)
+		keys := make([]string, 0, len(pathParams))
+		for key := range pathParams {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			io.WriteString(w, key+"="+pathParams[key]+";")
+		}
+	}
+	for _, path := range []string{
+		"/users/:id",
+		"/users/:name/posts",
+		"/users/:user/posts/:post",
+		"/users/:x<int>/friends",
+		"/users/:y<int>/enemies",
+		"/users/:name/files/*path",
+	} {
+		if err := mux.GetFunc(path, writeParams); err != nil {
+			t.Errorf("Expected no error defining %s, got %s", path, err)
+		}
+	}
+
+	assertBodyEquals(t, mux, "GET", "/users/bob", "id=bob;")
+	assertBodyEquals(t, mux, "GET", "/users/bob/posts", "name=bob;")
+	assertBodyEquals(t, mux, "GET", "/users/bob/posts/6", "post=6;user=bob;")
+	assertBodyEquals(t, mux, "GET", "/users/5/posts", "name=5;")
+	assertBodyEquals(t, mux, "GET", "/users/5/friends", "x=5;")
+	assertBodyEquals(t, mux, "GET", "/users/5/enemies", "y=5;")
+	assertBodyEquals(t, mux, "GET", "/users/bob/files/a/b", "name=bob;path=a/b;")
+
+	expectedErrors := map[string]struct {
+		segment int
+		message string
+	}{
+		"/users/:other":             {1, "GET /users/:other (segment 1): Path param already defined: ':other' as ':id'"},
+		"/users/:other/posts/:post": {1, "GET /users/:other/posts/:post (segment 1): Path param already defined: ':other' as ':user'"},
+		"/users/:user/posts/:other": {3, "GET /users/:user/posts/:other (segment 3): Path param already defined: ':other' as ':post'"},
+		"/users/:z<int>/friends":    {1, "GET /users/:z<int>/friends (segment 1): Path param already defined: ':z<int>' as ':x'"},
+	}
+	for path, expected := range expectedErrors {
+		err := mux.GetFunc(path, writeParams)
+		var routeErr *RouteError
+		if !errors.As(err, &routeErr) || !errors.Is(err, ErrPathParamConflict) {
+			t.Errorf("Expected ErrPathParamConflict defining %s, got %v", path, err)
+			continue
+		}
+		if routeErr.Segment != expected.segment || err.Error() != expected.message {
+			t.Errorf("Expected error %q at segment %d defining %s, got %q at segment %d", expected.message, expected.segment, path, err, routeErr.Segment)
+		}
+	}
+}
+
+func TestMuxBacktracking(t *testing.T) {
+	mux := newMuxWithGetPaths([]string{
+		"/foo/bar",
+		"/foo/:id/baz",
+		"/foo/:id<int>/qux",
+		"/foo/*rest",
+		"/a/b/c",
+		"/a/:x/d",
+		"/a/b/:y/e",
+		"/a/*rest",
+	})
+
+	expectations := []struct {
+		requestedPath      string
+		expectedBody       string
+		expectedPathParams map[string]string
+	}{
+		{"/foo/bar", "/foo/bar", map[string]string{}},
+		{"/foo/bar/baz", "/foo/:id/baz", map[string]string{"id": "bar"}},
+		{"/foo/5/baz", "/foo/:id/baz", map[string]string{"id": "5"}},
+		{"/foo/5/qux", "/foo/:id<int>/qux", map[string]string{"id": "5"}},
+		{"/foo/bar/qux", "/foo/*rest", map[string]string{"rest": "bar/qux"}},
+		{"/a/b/c", "/a/b/c", map[string]string{}},
+		{"/a/b/d", "/a/:x/d", map[string]string{"x": "b"}},
+		{"/a/b/c/e", "/a/b/:y/e", map[string]string{"y": "c"}},
+		{"/a/b/c/f", "/a/*rest", map[string]string{"rest": "b/c/f"}},
+	}
+	for _, e := range expectations {
+		assertBodyEquals(t, mux, "GET", e.requestedPath, e.expectedBody)
+		p := &Params{}
+		mux.match("GET", e.requestedPath, p)
+		if p.Len() != len(e.expectedPathParams) {
+			t.Errorf("Expected path params %q for %s, got %+v", e.expectedPathParams, e.requestedPath, p.values)
+		}
+		for name, value := range e.expectedPathParams {
+			if p.Get(name) != value {
+				t.Errorf("Expected path params %q for %s, got %+v", e.expectedPathParams, e.requestedPath, p.values)
+			}
+		}
+	}
+}
+
+func TestMuxMatchStaticZeroAllocs(t *testing.T) {
+	mux := newMuxWithGetPaths([]string{
+		"/",
+		"/foo/bar",
+		"/foo/:id/baz",
+		"/foo/*rest",
+	})
+	p := &Params{}
+	for _, path := range []string{"/", "/foo/bar", "/undefined"} {
+		allocs := testing.AllocsPerRun(100, func() {
+			mux.match("GET", path, p)
+		})
+		if allocs != 0 {
+			t.Errorf("Expected matching %s to not allocate, got %.0f allocs", path, allocs)
+		}
+	}
+}
+
+func TestMuxMatchParamsZeroAllocs(t *testing.T) {
+	mux := newMuxWithGetPaths([]string{
+		"/foo/:id<int>/baz",
+		"/foo/:id<uint>/qux",
+		"/foo/:name/baz",
+		"/foo/*rest",
+		"/users/:user/posts/:post<[0-9a-f]+>",
+	})
+	for _, path := range []string{"/foo/42/baz", "/foo/42/qux", "/foo/bar/baz", "/foo/-1/qux", "/foo/a/b/c", "/users/bob/posts/1f"} {
+		p := getParams()
+		allocs := testing.AllocsPerRun(100, func() {
+			p.values = p.values[:0]
+			mux.match("GET", path, p)
+		})
+		if allocs != 0 {
+			t.Errorf("Expected matching %s to not allocate, got %.0f allocs", path, allocs)
+		}
+		if p.Len() == 0 {
+			t.Errorf("Expected path params matching %s", path)
+		}
+		putParams(p)
+	}
+}
+
+func TestMuxServeParamsAllocs(t *testing.T) {
+	mux := New()
+	mux.GetFunc("/foo", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {})
+	mux.GetFunc("/foo/:id<int>/bar/:name", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		PathParamInt(ctx, "id")
+	})
+	mux.GetFunc("/users/:id/posts/*rest", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		ParamsFromContext(r.Context()).Get("rest")
+	})
+	// Serving allocates the context holding the path params and the copy of
+	// the request it is attached to, whether or not the route has path params
+	const maxAllocs = 2
+	for _, path := range []string{"/foo", "/users/5/posts/a/b", "/foo/5/bar/baz"} {
+		r, _ := http.NewRequest("GET", path, nil)
+		allocs := testing.AllocsPerRun(100, func() {
+			mux.ServeHTTP(nil, r)
+		})
+		if allocs > maxAllocs {
+			t.Errorf("Expected serving %s to allocate at most %d times, got %.0f allocs", path, maxAllocs, allocs)
+		}
+	}
+}
+
+func TestMuxConcurrentAddAndServe(t *testing.T) {
+	mux := New()
+	handler := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {}
+	mux.GetFunc("/", handler)
+	var paths []string
+	for n := 0; n < 50; n++ {
+		paths = append(paths, fmt.Sprintf("/foo/%d", n), fmt.Sprintf("/bar/%d/:id", n))
+	}
+	var wg sync.WaitGroup
+	for _, path := range paths {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			if err := mux.GetFunc(path, handler); err != nil {
+				t.Errorf("Got error adding %s: %s", path, err)
+			}
+		}(path)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		mux.Use(func(next Handler) Handler { return next })
+	}()
+	for n := 0; n < 4; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, path := range paths {
+				r, _ := http.NewRequest("GET", strings.Replace(path, ":id", "42", 1), nil)
+				mux.ServeHTTP(httptest.NewRecorder(), r)
+				r, _ = http.NewRequest("OPTIONS", "/", nil)
+				mux.ServeHTTP(httptest.NewRecorder(), r)
+			}
+		}()
+	}
+	wg.Wait()
+	for _, path := range paths {
+		assertStatus(t, mux, "GET", strings.Replace(path, ":id", "42", 1), 200)
+	}
+}
+
+func TestMuxSnapshot(t *testing.T) {
+	mux := newMuxWithGetPaths([]string{"/foo/bar", "/foo/:id/baz", "/baz/*rest"})
+	before := mux.load()
+	mux.GetFunc("/foo/barbaz", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {})
+	mux.GetFunc("/foo/:name/qux", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {})
+	mux.GetFunc("/baz/*rest", nil)
+	if err := mux.GetFunc("/foo/:name/baz", nil); err == nil {
+		t.Error("Expected error adding conflicting route")
+	}
+	after := mux.load()
+	if before == after {
+		t.Fatal("Expected snapshot to be replaced")
+	}
+	for _, tc := range []struct {
+		path          string
+		beforeDefined bool
+		afterDefined  bool
+	}{
+		{"foo/bar", true, true},
+		{"foo/barbaz", false, true},
+		{"foo/42/baz", true, true},
+		{"foo/42/qux", false, true},
+		{"baz/x/y", true, false},
+	} {
+		for _, s := range []struct {
+			snapshot *routes
+			defined  bool
+		}{{before, tc.beforeDefined}, {after, tc.afterDefined}} {
+			n, _ := s.snapshot.trees["GET"].match(tc.path, nil)
+			if defined := n != nil && n.handler != nil; defined != s.defined {
+				t.Errorf("%s: got defined %t, expected %t", tc.path, defined, s.defined)
+			}
+		}
+	}
+	n, _ := after.trees["GET"].match("foo/42/baz", nil)
+	if n.paramNames[0] != "id" {
+		t.Errorf("Expected failed add to leave param name 'id', got '%s'", n.paramNames[0])
+	}
+}
+
+func TestMuxRemove(t *testing.T) {
+	mux := newMuxWithGetPaths([]string{
+		"/foo",
+		"/foo/",
+		"/foo/bar",
+		"/users/:id",
+		"/users/:name/posts",
+		"/static/*filepath",
+	})
+	mux.PostFunc("/foo", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {})
+
+	if err := mux.Remove("GET", "/foo/"); err != nil {
+		t.Errorf("Got error removing /foo/: %s", err)
+	}
+	assertStatus(t, mux, "GET", "/foo", http.StatusOK)
+	assertHeader(t, mux, "GET", "/foo/", "Location", "/foo")
+	assertBodyEquals(t, mux, "GET", "/foo/bar", "/foo/bar")
+
+	if err := mux.Remove("GET", "/foo"); err != nil {
+		t.Errorf("Got error removing /foo: %s", err)
+	}
+	assertStatus(t, mux, "GET", "/foo/", http.StatusNotFound)
+	assertStatus(t, mux, "GET", "/foo", http.StatusMethodNotAllowed)
+	assertStatus(t, mux, "POST", "/foo", http.StatusOK)
+	assertBodyEquals(t, mux, "GET", "/foo/bar", "/foo/bar")
+
+	if err := mux.Remove("GET", "/users/:name"); !errors.Is(err, ErrRouteNotDefined) {
+		t.Errorf("Expected ErrRouteNotDefined removing /users/:name, got %v", err)
+	}
+	if err := mux.Remove("GET", "/users/:id"); err != nil {
+		t.Errorf("Got error removing /users/:id: %s", err)
+	}
+	assertStatus(t, mux, "GET", "/users/42", http.StatusNotFound)
+	assertBodyEquals(t, mux, "GET", "/users/42/posts", "/users/:name/posts")
+	assertPathParams(t, mux, "GET", "/users/:name/posts", "/users/42/posts", map[string]string{"name": "42"})
+
+	if err := mux.Remove("GET", "/static/*path"); !errors.Is(err, ErrRouteNotDefined) {
+		t.Errorf("Expected ErrRouteNotDefined removing /static/*path, got %v", err)
+	}
+	if err := mux.Remove("GET", "/static/*filepath"); err != nil {
+		t.Errorf("Got error removing /static/*filepath: %s", err)
+	}
+	assertStatus(t, mux, "GET", "/static/foo.css", http.StatusNotFound)
+
+	for _, path := range []string{"/foo", "/foo/ba", "/bar", "/users/", "foo"} {
+		if err := mux.Remove("GET", path); err == nil {
+			t.Errorf("Expected error removing %s", path)
+		}
+	}
+	if err := mux.Remove("PUT", "/foo"); !errors.Is(err, ErrRouteNotDefined) {
+		t.Errorf("Expected ErrRouteNotDefined removing PUT /foo, got %v", err)
+	}
+
+	mux.Remove("GET", "/foo/bar")
+	mux.Remove("GET", "/users/:name/posts")
+	if _, ok := mux.load().trees["GET"]; ok {
+		t.Error("Expected GET tree to be removed along with its last route")
+	}
+	assertStatus(t, mux, "GET", "/foo/bar", http.StatusNotFound)
+}
+
+func TestMuxReplace(t *testing.T) {
+	mux := newMuxWithGetPaths([]string{"/foo", "/foo/:id"})
+	err := mux.ReplaceFunc("GET", "/foo/:id", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "replaced "+PathParams(ctx)["id"])
+	})
+	if err != nil {
+		t.Errorf("Got error replacing /foo/:id: %s", err)
+	}
+	assertBodyEquals(t, mux, "GET", "/foo/42", "replaced 42")
+	assertBodyEquals(t, mux, "GET", "/foo", "/foo")
+
+	for _, path := range []string{"/foo/", "/bar", "/foo/:name"} {
+		if err := mux.ReplaceFunc("GET", path, nil); !errors.Is(err, ErrRouteNotDefined) {
+			t.Errorf("Expected ErrRouteNotDefined replacing %s, got %v", path, err)
+		}
+	}
+	assertStatus(t, mux, "GET", "/foo/", http.StatusMovedPermanently)
+
+	mux.ReplaceFunc("GET", "/foo", nil)
+	assertStatus(t, mux, "GET", "/foo", http.StatusNotFound)
+}
+
+func TestMuxRejectDuplicateRoutes(t *testing.T) {
+	mux := newMuxWithGetPaths([]string{"/foo", "/users/:id<int>"})
+	mux.GetFunc("/foo", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "overwritten")
+	})
+	assertBodyEquals(t, mux, "GET", "/foo", "overwritten")
+
+	mux.RejectDuplicateRoutes = true
+	for _, path := range []string{"/foo", "/users/:id<int>"} {
+		err := mux.GetFunc(path, func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "duplicate")
+		})
+		var routeErr *RouteError
+		if !errors.As(err, &routeErr) || !errors.Is(err, ErrDuplicateRoute) {
+			t.Errorf("Expected ErrDuplicateRoute adding %s, got %v", path, err)
+			continue
+		}
+		if routeErr.Method != "GET" || routeErr.Path != path {
+			t.Errorf("Expected error naming GET %s, got %s %s", path, routeErr.Method, routeErr.Path)
+		}
+	}
+	assertBodyEquals(t, mux, "GET", "/foo", "overwritten")
+	assertBodyEquals(t, mux, "GET", "/users/42", "/users/:id<int>")
+
+	if err := mux.GetFunc("/users/:name<int>", nil); !errors.Is(err, ErrPathParamConflict) {
+		t.Errorf("Expected ErrPathParamConflict adding differently named path param, got %v", err)
+	}
+	for _, path := range []string{"/foo/", "/users/:id", "/users/:id<int>/posts"} {
+		if err := mux.GetFunc(path, nil); err != nil {
+			t.Errorf("Got error adding %s: %s", path, err)
+		}
+	}
+	if err := mux.PostFunc("/foo", nil); err != nil {
+		t.Errorf("Got error adding POST /foo: %s", err)
+	}
+
+	mux.ReplaceFunc("GET", "/foo", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "replaced")
+	})
+	assertBodyEquals(t, mux, "GET", "/foo", "replaced")
+
+	mux.Remove("GET", "/foo")
+	if err := mux.GetFunc("/foo", nil); err != nil {
+		t.Errorf("Got error adding removed route: %s", err)
+	}
+}
+
+func TestMuxMust(t *testing.T) {
+	mux := New().Must()
+	if !mux.PanicOnError {
+		t.Error("Expected Must to set PanicOnError")
+	}
+	if err := mux.GetFunc("/foo", nil); err != nil {
+		t.Errorf("Got error adding /foo: %s", err)
+	}
+
+	assertPanics := func(name string, f func()) {
+		defer func() {
+			if err, ok := recover().(error); !ok || !errors.Is(err, ErrNoLeadingSlash) {
+				t.Errorf("Expected %s to panic with ErrNoLeadingSlash, got %v", name, err)
+			}
+		}()
+		f()
+	}
+	assertPanics("GetFunc", func() { mux.GetFunc("foo", nil) })
+	assertPanics("Group.GetFunc", func() { mux.Group("bar").GetFunc("/baz", nil) })
+	assertPanics("Routes", func() { mux.Routes([]Route{{"GET", "foo", nil}}) })
+
+	if err := mux.Remove("GET", "foo"); !errors.Is(err, ErrNoLeadingSlash) {
+		t.Errorf("Expected Remove to return ErrNoLeadingSlash, got %v", err)
+	}
+}
+
+func TestMuxRoutes(t *testing.T) {
+	mux := New()
+	mux.RejectDuplicateRoutes = true
+	writePath := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Path)
+	}
+	err := mux.Routes([]Route{
+		{"GET", "/foo", HandlerFunc(writePath)},
+		{"POST", "/foo", HandlerFunc(writePath)},
+		{"GET", "/users/:id", HandlerFunc(writePath)},
+	})
+	if err != nil {
+		t.Errorf("Got error adding routes: %s", err)
+	}
+	assertBodyEquals(t, mux, "GET", "/foo", "/foo")
+	assertBodyEquals(t, mux, "POST", "/foo", "/foo")
+	assertBodyEquals(t, mux, "GET", "/users/42", "/users/42")
+
+	err = mux.Routes([]Route{
+		{"GET", "/bar", HandlerFunc(writePath)},
+		{"GET", "bar", HandlerFunc(writePath)},
+		{"GET", "/foo", HandlerFunc(writePath)},
+		{"GET", "/users/:name", HandlerFunc(writePath)},
+		{"GET", "/baz", HandlerFunc(writePath)},
+		{"GET", "/baz", HandlerFunc(writePath)},
+	})
+	errs, ok := err.(RouteErrors)
+	if !ok {
+		t.Fatalf("Expected RouteErrors, got %v", err)
+	}
+	expectedErrs := []struct {
+		path string
+		err  error
+	}{
+		{"bar", ErrNoLeadingSlash},
+		{"/foo", ErrDuplicateRoute},
+		{"/users/:name", ErrPathParamConflict},
+		{"/baz", ErrDuplicateRoute},
+	}
+	if len(errs) != len(expectedErrs) {
+		t.Fatalf("Expected %d errors, got %d: %s", len(expectedErrs), len(errs), errs)
+	}
+	for n, e := range expectedErrs {
+		if errs[n].Path != e.path || !errors.Is(errs[n], e.err) {
+			t.Errorf("Expected error %q for %s, got %q", e.err, e.path, errs[n])
+		}
+	}
+	assertStatus(t, mux, "GET", "/bar", http.StatusNotFound)
+	assertStatus(t, mux, "GET", "/baz", http.StatusNotFound)
+}
+
+func TestMuxHandle(t *testing.T) {
+	mux := New()
+	writeMethod := func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Method)
+	}
+	for _, method := range []string{"PROPFIND", "MKCOL", "PURGE", "X-Custom_1"} {
+		if err := mux.HandleFunc(method, "/foo", writeMethod); err != nil {
+			t.Errorf("Got error handling %s: %s", method, err)
+		}
+		assertBodyEquals(t, mux, method, "/foo", method)
+	}
+	assertStatus(t, mux, "GET", "/foo", http.StatusMethodNotAllowed)
+	assertHeader(t, mux, "GET", "/foo", "Allow", "MKCOL, OPTIONS, PROPFIND, PURGE, X-Custom_1")
+
+	for _, method := range []string{"", "GET /", "PROP(FIND", "MÉTHOD", "GET\n"} {
+		if err := mux.HandleFunc(method, "/foo", writeMethod); !errors.Is(err, ErrInvalidMethod) {
+			t.Errorf("Expected ErrInvalidMethod handling %q, got %v", method, err)
+		}
+	}
+}
+
+func TestMuxAny(t *testing.T) {
+	mux := New()
+	err := mux.AnyFunc("/foo", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "any")
+	})
+	if err != nil {
+		t.Errorf("Got error adding any route: %s", err)
+	}
+	for _, method := range anyMethods {
+		assertStatus(t, mux, method, "/foo", http.StatusOK)
+	}
+	assertBodyEquals(t, mux, "OPTIONS", "/foo", "any")
+	assertStatus(t, mux, "PROPFIND", "/foo", http.StatusMethodNotAllowed)
+
+	mux.RejectDuplicateRoutes = true
+	mux.PostFunc("/bar", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {})
+	if err := mux.AnyFunc("/bar", nil); !errors.Is(err, ErrDuplicateRoute) {
+		t.Errorf("Expected ErrDuplicateRoute, got %v", err)
+	}
+	assertStatus(t, mux, "GET", "/bar", http.StatusMethodNotAllowed)
+}
+
+func TestMuxConnect(t *testing.T) {
+	mux := New()
+	mux.RedirectCleanPath = true
+	mux.RedirectCaseInsensitive = true
+	mux.AnyFunc("/", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {})
+	mux.Mount("/", HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {}))
+	r, err := http.ReadRequest(bufio.NewReader(strings.NewReader("CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n")))
+	if err != nil {
+		t.Fatalf("Got error reading request: %s", err)
+	}
+	if r.URL.Path != "" {
+		t.Fatalf("Expected CONNECT request without path, got %q", r.URL.Path)
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected HTTP %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestMuxRequestContext(t *testing.T) {
+	type key struct{}
+	mux := New()
+	mux.GetFunc("/users/:id", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Context() != ctx {
+			t.Error("Expected context to be attached to request")
+		}
+		if ctx.Err() == nil {
+			t.Error("Expected context of request to be canceled")
+		}
+		io.WriteString(w, ctx.Value(key{}).(string)+" "+PathParams(r.Context())["id"])
+	})
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "value"))
+	cancel()
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/users/5", nil)
+	mux.ServeHTTP(w, r.WithContext(ctx))
+	if w.Body.String() != "value 5" {
+		t.Errorf("Expected \"value 5\", got %q", w.Body.String())
+	}
+}
+
+func TestXNetContextCompatibility(t *testing.T) {
+	mux := New()
+	handler := func(ctx xcontext.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "user "+PathParams(ctx)["id"])
+	}
+	mux.GetFunc("/users/:id", handler)
+	mux.Get("/friends/:id", HandlerFunc(handler))
+	mux.RedirectHandler = func(ctx xcontext.Context, w http.ResponseWriter, r *http.Request, url string, code int) {
+		http.Redirect(w, r, url, code)
+	}
+	assertBodyEquals(t, mux, "GET", "/users/5", "user 5")
+	assertBodyEquals(t, mux, "GET", "/friends/6", "user 6")
+	w := httptest.NewRecorder()
+	mux.ServeHTTPC(xcontext.Background(), w, httptest.NewRequest("GET", "/users/5/", nil))
+	if w.Code != http.StatusMovedPermanently {
+		t.Errorf("Expected HTTP %d, got %d", http.StatusMovedPermanently, w.Code)
+	}
+}
+
 func TestSplitString(t *testing.T) {
 	stringSplits := map[string][]string{
 		"":           {""},
@@ -408,6 +1289,7 @@ func splitSlicesEqual(a, b []string) bool {
 }
 
 func BenchmarkMuxStaticSimple(b *testing.B) {
+	b.ReportAllocs()
 	mux := New()
 	mux.GetFunc("/foo", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {})
 	for n := 0; n < b.N; n++ {
@@ -420,3 +1302,96 @@ func BenchmarkMuxStaticSimple(b *testing.B) {
 		b.StopTimer()
 	}
 }
+
+func largeRouteSet() (static []string, params []string) {
+	resources := []string{
+		"users", "repos", "orgs", "gists", "issues", "pulls", "teams", "events",
+		"projects", "releases", "hooks", "keys", "labels", "milestones", "commits",
+		"branches", "tags", "comments", "reactions", "notifications",
+	}
+	for _, resource := range resources {
+		static = append(static,
+			"/"+resource,
+			"/"+resource+"/search",
+			"/"+resource+"/recent/",
+			"/api/v1/"+resource,
+			"/api/v1/"+resource+"/stats",
+		)
+		params = append(params,
+			"/"+resource+"/:id",
+			"/"+resource+"/:id/items",
+			"/"+resource+"/:id/items/:item",
+			"/api/v1/"+resource+"/:id/settings",
+		)
+	}
+	return static, params
+}
+
+func benchmarkMuxRequests(b *testing.B, mux *Mux, paths []string) {
+	requests := make([]*http.Request, len(paths))
+	for n, path := range paths {
+		requests[n], _ = http.NewRequest("GET", path, nil)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		mux.ServeHTTP(nil, requests[n%len(requests)])
+	}
+}
+
+func newMuxWithLargeRouteSet() *Mux {
+	static, params := largeRouteSet()
+	mux := New()
+	for _, path := range append(static, params...) {
+		mux.GetFunc(path, func(ctx context.Context, w http.ResponseWriter, r *http.Request) {})
+	}
+	return mux
+}
+
+func BenchmarkMuxStaticLarge(b *testing.B) {
+	mux := newMuxWithLargeRouteSet()
+	benchmarkMuxRequests(b, mux, []string{
+		"/users",
+		"/repos/search",
+		"/notifications/recent/",
+		"/api/v1/milestones/stats",
+	})
+}
+
+func BenchmarkMuxParamsLarge(b *testing.B) {
+	mux := newMuxWithLargeRouteSet()
+	benchmarkMuxRequests(b, mux, []string{
+		"/users/42",
+		"/repos/42/items",
+		"/notifications/42/items/7",
+		"/api/v1/milestones/42/settings",
+	})
+}
+
+func benchmarkMatch(b *testing.B, mux *Mux, paths []string) {
+	p := getParams()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		p.values = p.values[:0]
+		mux.match("GET", paths[n%len(paths)], p)
+	}
+}
+
+func BenchmarkMatchStaticLarge(b *testing.B) {
+	benchmarkMatch(b, newMuxWithLargeRouteSet(), []string{
+		"/users",
+		"/repos/search",
+		"/notifications/recent/",
+		"/api/v1/milestones/stats",
+	})
+}
+
+func BenchmarkMatchParamsLarge(b *testing.B) {
+	benchmarkMatch(b, newMuxWithLargeRouteSet(), []string{
+		"/users/42",
+		"/repos/42/items",
+		"/notifications/42/items/7",
+		"/api/v1/milestones/42/settings",
+	})
+}
@@ -0,0 +1,155 @@
+package moku
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// mount is a handler mounted at a prefix, serving all methods and paths
+// below the prefix.
+type mount struct {
+	prefix  string
+	handler Handler
+}
+
+// mountPaths holds the prefix stripped from the request path by mounts and
+// the remaining path.
+type mountPaths struct {
+	prefix string
+	path   string
+}
+
+// Mount mounts handler, such as another Mux, at given prefix. Requests of any
+// method for paths below the prefix that match no route of the mux, and are not
+// redirected by it, are served by the handler, with the prefix stripped from
+// r.URL.Path. If RedirectCleanPath is true, requests for unclean paths below
+// the prefix are redirected to the cleaned path first. A request for the
+// prefix itself is redirected to the prefix with a trailing slash if
+// RedirectTrailingSlash is true, and otherwise served with the path "/".
+// The prefix must be static; path params are not allowed. If several mounts
+// match a path, the one with the longest prefix is used.
+//
+// The stripped prefix and the remaining path are available to the handler
+// using MountPrefix and MountPath. A mounted Mux prefixes the paths it
+// redirects to with the stripped prefix.
+//
+//	admin := moku.New()
+//	admin.GetFunc("/users", listUsers)
+//	mux.Mount("/admin", admin)
+func (m *Mux) Mount(prefix string, handler Handler) error {
+	handler = nilIfNilFunc(handler)
+	return m.addRoutes(func(r *routes) error {
+		return r.addMount(prefix, handler, !m.RejectDuplicateRoutes)
+	})
+}
+
+// MountHTTP mounts an http.Handler at given prefix, see Mount.
+func (m *Mux) MountHTTP(prefix string, handler http.Handler) error {
+	return m.Mount(prefix, HTTPHandler(handler))
+}
+
+// Mount mounts handler at given prefix below the prefix of the group, see
+// Mux.Mount.
+func (g *Group) Mount(prefix string, handler Handler) error {
+	return g.mux.Mount(g.prefix+prefix, g.wrap(nilIfNilFunc(handler)))
+}
+
+// MountHTTP mounts an http.Handler at given prefix below the prefix of the
+// group, see Mux.Mount.
+func (g *Group) MountHTTP(prefix string, handler http.Handler) error {
+	return g.Mount(prefix, HTTPHandler(handler))
+}
+
+// addMount adds a mount to r, keeping the mounts ordered by descending prefix
+// length. If a mount is already defined at the prefix its handler is replaced
+// if replace is true, and ErrDuplicateRoute is returned otherwise.
+func (r *routes) addMount(prefix string, handler Handler, replace bool) error {
+	if err := checkRoute("*", prefix); err != nil {
+		return err
+	}
+	prefix = strings.TrimSuffix(prefix, "/")
+	for n, segment := range strings.Split(prefix, "/")[1:] {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			return &RouteError{Method: "*", Path: prefix, Segment: n, Err: ErrMountPrefixNotStatic}
+		}
+	}
+	mounts := make([]*mount, 0, len(r.mounts)+1)
+	added := false
+	for _, mnt := range r.mounts {
+		if mnt.prefix == prefix {
+			if !replace {
+				return &RouteError{Method: "*", Path: prefix, Segment: -1, Err: ErrDuplicateRoute}
+			}
+			mnt = &mount{prefix, handler}
+			added = true
+		} else if !added && len(mnt.prefix) < len(prefix) {
+			mounts = append(mounts, &mount{prefix, handler})
+			added = true
+		}
+		mounts = append(mounts, mnt)
+	}
+	if !added {
+		mounts = append(mounts, &mount{prefix, handler})
+	}
+	r.mounts = mounts
+	return nil
+}
+
+// findMount returns the mount with the longest prefix matching given path, or
+// nil if there is none.
+func (m *Mux) findMount(path string) *mount {
+	for _, mnt := range m.load().mounts {
+		if mnt.handler == nil {
+			continue
+		}
+		if !strings.HasPrefix(path, mnt.prefix) {
+			continue
+		}
+		if rest := path[len(mnt.prefix):]; rest == "" || rest[0] == '/' {
+			return mnt
+		}
+	}
+	return nil
+}
+
+// ServeHTTPC calls the mounted handler with the prefix stripped from the
+// request path.
+func (mnt *mount) ServeHTTPC(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	paths := &mountPaths{prefix: MountPrefix(ctx) + mnt.prefix}
+	paths.path = strings.TrimPrefix(r.URL.Path, mnt.prefix)
+	if paths.path == "" {
+		paths.path = "/"
+	}
+	ctx = context.WithValue(ctx, mountKey, paths)
+	r = r.WithContext(ctx)
+	u := *r.URL
+	u.Path = paths.path
+	if u.RawPath != "" {
+		u.RawPath = strings.TrimPrefix(u.RawPath, mnt.prefix)
+		if u.RawPath == "" || u.RawPath[0] != '/' {
+			u.RawPath = ""
+		}
+	}
+	r.URL = &u
+	mnt.handler.ServeHTTPC(ctx, w, r)
+}
+
+// MountPrefix returns the prefix stripped from the request path by mounts,
+// including those of enclosing muxes, or an empty string if the request is
+// not served by a mounted handler.
+func MountPrefix(ctx context.Context) string {
+	if paths, ok := ctx.Value(mountKey).(*mountPaths); ok {
+		return paths.prefix
+	}
+	return ""
+}
+
+// MountPath returns the request path with the prefix stripped by mounts, or
+// an empty string if the request is not served by a mounted handler.
+func MountPath(ctx context.Context) string {
+	if paths, ok := ctx.Value(mountKey).(*mountPaths); ok {
+		return paths.path
+	}
+	return ""
+}
@@ -0,0 +1,144 @@
+package moku
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func writeMountPaths(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(w, "%s %s %s %s", r.Method, MountPrefix(ctx), MountPath(r.Context()), r.URL.Path)
+}
+
+func TestMuxMount(t *testing.T) {
+	admin := New()
+	admin.GetFunc("/", writeMountPaths)
+	admin.GetFunc("/users", writeMountPaths)
+	admin.HandleFunc("PROPFIND", "/users", writeMountPaths)
+	admin.GetFunc("/users/:id", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "user "+PathParams(ctx)["id"])
+	})
+
+	mux := New()
+	mux.GetFunc("/admin/special", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "special")
+	})
+	if err := mux.Mount("/admin", admin); err != nil {
+		t.Fatalf("Got error mounting: %s", err)
+	}
+
+	assertBodyEquals(t, mux, "GET", "/admin/users", "GET /admin /users /users")
+	assertBodyEquals(t, mux, "PROPFIND", "/admin/users", "PROPFIND /admin /users /users")
+	assertBodyEquals(t, mux, "GET", "/admin/users/5", "user 5")
+	assertBodyEquals(t, mux, "GET", "/admin/", "GET /admin / /")
+	assertBodyEquals(t, mux, "GET", "/admin/special", "special")
+	assertStatus(t, mux, "POST", "/admin/users", http.StatusMethodNotAllowed)
+	assertStatus(t, mux, "GET", "/admin/unknown", http.StatusNotFound)
+	assertStatus(t, mux, "GET", "/administrator", http.StatusNotFound)
+
+	// Redirects of the mounted mux keep the prefix
+	assertStatus(t, mux, "GET", "/admin/users/", http.StatusMovedPermanently)
+	assertHeader(t, mux, "GET", "/admin/users/?a=b", "Location", "/admin/users?a=b")
+
+	// Redirects of the mux take precedence over the mount
+	assertStatus(t, mux, "GET", "/admin/special/", http.StatusMovedPermanently)
+	assertHeader(t, mux, "GET", "/admin/special/", "Location", "/admin/special")
+
+	// The prefix itself is redirected to the prefix with a trailing slash
+	assertStatus(t, mux, "GET", "/admin", http.StatusMovedPermanently)
+	assertHeader(t, mux, "GET", "/admin", "Location", "/admin/")
+	mux.RedirectTrailingSlash = false
+	assertBodyEquals(t, mux, "GET", "/admin", "GET /admin / /")
+}
+
+func TestMuxMountCleanPath(t *testing.T) {
+	admin := New()
+	admin.GetFunc("/users", writeMountPaths)
+	mux := New()
+	mux.RedirectCleanPath = true
+	mux.Mount("/admin", admin)
+
+	for _, path := range []string{"/admin//users", "/x/../admin/users", "/admin/./users"} {
+		assertStatus(t, mux, "GET", path, http.StatusMovedPermanently)
+		assertHeader(t, mux, "GET", path, "Location", "/admin/users")
+	}
+	assertBodyEquals(t, mux, "GET", "/admin/users", "GET /admin /users /users")
+}
+
+func TestMuxMountHTTP(t *testing.T) {
+	mux := New()
+	mux.MountHTTP("/static/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", MountPrefix(r.Context()), r.URL.Path)
+	}))
+	assertBodyEquals(t, mux, "GET", "/static/css/site.css", "/static /css/site.css")
+	assertBodyEquals(t, mux, "DELETE", "/static/", "/static /")
+}
+
+func TestMuxMountNested(t *testing.T) {
+	inner := New()
+	inner.GetFunc("/users", writeMountPaths)
+	middle := New()
+	middle.Mount("/v1", inner)
+	mux := New()
+	mux.Mount("/api", middle)
+	mux.Group("/api").Mount("/v2", HandlerFunc(writeMountPaths))
+	mux.Mount("/", HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "fallback")
+	}))
+
+	assertBodyEquals(t, mux, "GET", "/api/v1/users", "GET /api/v1 /users /users")
+	assertHeader(t, mux, "GET", "/api/v1/users/", "Location", "/api/v1/users")
+	assertBodyEquals(t, mux, "GET", "/api/v2/users", "GET /api/v2 /users /users")
+	assertBodyEquals(t, mux, "GET", "/other", "fallback")
+}
+
+func TestMuxMountErrors(t *testing.T) {
+	mux := New()
+	for _, e := range []struct {
+		prefix      string
+		expectedErr error
+	}{
+		{"", ErrEmptyPath},
+		{"admin", ErrNoLeadingSlash},
+		{"/users/:id", ErrMountPrefixNotStatic},
+		{"/files/*path", ErrMountPrefixNotStatic},
+	} {
+		if err := mux.Mount(e.prefix, HandlerFunc(writeMountPaths)); !errors.Is(err, e.expectedErr) {
+			t.Errorf("Expected %q mounting at %q, got %v", e.expectedErr, e.prefix, err)
+		}
+	}
+
+	mux.Mount("/admin", HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "first")
+	}))
+	mux.Mount("/admin/", HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "second")
+	}))
+	assertBodyEquals(t, mux, "GET", "/admin/", "second")
+
+	mux.RejectDuplicateRoutes = true
+	if err := mux.Mount("/admin", nil); !errors.Is(err, ErrDuplicateRoute) {
+		t.Errorf("Expected ErrDuplicateRoute, got %v", err)
+	}
+	assertBodyEquals(t, mux, "GET", "/admin/", "second")
+}
+
+func TestAddMountOrder(t *testing.T) {
+	r := &routes{}
+	for _, prefix := range []string{"/a", "/a/b/c", "/", "/a/b", "/b"} {
+		if err := r.addMount(prefix, nil, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var prefixes []string
+	for _, mnt := range r.mounts {
+		prefixes = append(prefixes, mnt.prefix)
+	}
+	expected := []string{"/a/b/c", "/a/b", "/a", "/b", ""}
+	if !splitSlicesEqual(prefixes, expected) {
+		t.Errorf("Expected mounts %q, got %q", expected, prefixes)
+	}
+}
@@ -0,0 +1,91 @@
+package moku
+
+import (
+	"context"
+	"sync"
+)
+
+// Params holds the path params of a request in the order they occur in the
+// route. Params are pooled and reused once the request has been served, so
+// neither Params nor the context holding them may be used to get path params
+// after the handler has returned. The values themselves may be kept.
+type Params struct {
+	values []paramValue
+}
+
+// ParamsFromContext returns the path params held by given context, or nil if
+// there are none. The methods of Params may be called on nil.
+func ParamsFromContext(ctx context.Context) *Params {
+	p, _ := ctx.Value(pathParamsKey).(*Params)
+	return p
+}
+
+// Len returns the number of path params.
+func (p *Params) Len() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.values)
+}
+
+// Get returns the value of the path param of given name, or an empty string
+// if there is none.
+func (p *Params) Get(name string) string {
+	v, _ := p.lookup(name)
+	return v.value
+}
+
+// ByIndex returns the name and value of path param i, counting from 0. It
+// panics if i is out of range.
+func (p *Params) ByIndex(i int) (name string, value string) {
+	v := p.values[i]
+	return v.name, v.value
+}
+
+// lookup returns the path param of given name. If there are several, as with
+// nested muxes, the last one is returned.
+func (p *Params) lookup(name string) (paramValue, bool) {
+	for i := p.Len() - 1; i >= 0; i-- {
+		if p.values[i].name == name {
+			return p.values[i], true
+		}
+	}
+	return paramValue{}, false
+}
+
+// PathParams returns the path params held by given context as a map of names
+// to values. The map is empty for routes without path params, and nil only if
+// the request was not served by a mux. The map is created on each call and
+// may be kept or written to, but writes are not seen by later calls.
+// ParamsFromContext(ctx).Get looks up a single path param without allocating.
+func PathParams(ctx context.Context) map[string]string {
+	p := ParamsFromContext(ctx)
+	if p == nil {
+		return nil
+	}
+	m := make(map[string]string, p.Len())
+	for _, v := range p.values {
+		m[v.name] = v.value
+	}
+	return m
+}
+
+var paramsPool = sync.Pool{
+	New: func() interface{} {
+		return &Params{values: make([]paramValue, 0, 8)}
+	},
+}
+
+// getParams returns empty Params from the pool.
+func getParams() *Params {
+	return paramsPool.Get().(*Params)
+}
+
+// putParams empties p and returns it to the pool.
+func putParams(p *Params) {
+	for i := range p.values {
+		p.values[i] = paramValue{}
+	}
+	p.values = p.values[:0]
+	paramsPool.Put(p)
+}
@@ -0,0 +1,94 @@
+package moku
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestParams(t *testing.T) {
+	mux := New()
+	mux.GetFunc("/users/:user/posts/:post/*rest", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		p := ParamsFromContext(ctx)
+		for i := 0; i < p.Len(); i++ {
+			name, value := p.ByIndex(i)
+			fmt.Fprintf(w, "%s=%s;", name, value)
+		}
+		io.WriteString(w, p.Get("post")+";"+p.Get("undefined"))
+	})
+	assertBodyEquals(t, mux, "GET", "/users/bob/posts/6/a/b", "user=bob;post=6;rest=a/b;6;")
+}
+
+func TestParamsNil(t *testing.T) {
+	p := ParamsFromContext(context.Background())
+	if p != nil {
+		t.Errorf("Expected nil params, got %+v", p)
+	}
+	if p.Len() != 0 || p.Get("foo") != "" {
+		t.Error("Expected nil params to be empty")
+	}
+	if PathParams(context.Background()) != nil {
+		t.Error("Expected nil path params map")
+	}
+}
+
+func TestPathParamsStaticRoute(t *testing.T) {
+	mux := New()
+	mux.GetFunc("/foo", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		p := PathParams(ctx)
+		if p == nil {
+			t.Error("Expected non-nil path params map for static route")
+		}
+		p["x"] = "y"
+		if PathParams(ctx)["x"] != "" {
+			t.Error("Expected writes to path params map not to be seen by later calls")
+		}
+	})
+	assertStatus(t, mux, "GET", "/foo", http.StatusOK)
+}
+
+func TestParamsRecycled(t *testing.T) {
+	mux := New()
+	var kept *Params
+	var keptMap map[string]string
+	mux.GetFunc("/users/:id", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		kept = ParamsFromContext(ctx)
+		keptMap = PathParams(ctx)
+	})
+	assertStatus(t, mux, "GET", "/users/5", http.StatusOK)
+	if kept.Len() != 0 {
+		t.Errorf("Expected params to be emptied once served, got %+v", kept.values)
+	}
+	if keptMap["id"] != "5" {
+		t.Errorf("Expected path params map to be kept, got %q", keptMap)
+	}
+}
+
+func TestParamsNestedMux(t *testing.T) {
+	inner := New()
+	inner.GetFunc("/users/:id/posts/:post", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		p := ParamsFromContext(ctx)
+		for i := 0; i < p.Len(); i++ {
+			name, value := p.ByIndex(i)
+			fmt.Fprintf(w, "%s=%s;", name, value)
+		}
+		io.WriteString(w, "id="+p.Get("id")+";")
+	})
+	inner.GetFunc("/users/:name/files", func(ctx context.Context, w http.ResponseWriter, r *http.Request) {})
+
+	outer := New()
+	outer.Use(func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTPC(ctx, w, r)
+			fmt.Fprintf(w, "|outer %q", PathParams(ctx))
+		})
+	})
+	outer.Get("/users/:uid/*rest", inner)
+
+	assertBodyEquals(t, outer, "GET", "/users/5/posts/6",
+		`uid=5;rest=posts/6;id=5;post=6;id=5;|outer map["rest":"posts/6" "uid":"5"]`)
+	assertBodyEquals(t, outer, "GET", "/users/5/unknown",
+		`404 page not found`+"\n"+`|outer map["rest":"unknown" "uid":"5"]`)
+}
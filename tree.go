@@ -0,0 +1,395 @@
+package moku
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// node is a node of a routes tree, of which there is one per method. A routes
+// tree is a compressed radix tree over the paths of its routes without their
+// leading slash. Static children are indexed by the first byte of their
+// prefix, which holds the static part of the path between their parent and
+// themselves, so that chains of nodes with single children are merged into
+// one. Path params and catch-alls are kept apart from static children and only
+// occur where a path segment begins.
+//
+// Nodes are never altered once part of a routes tree being served. Routes are
+// added to copies of the nodes on the way to the route, see clone.
+type node struct {
+	prefix     string
+	indices    string
+	children   []*node
+	pathParams []*pathParam
+	catchAll   struct {
+		name string
+		node *node
+	}
+	handler Handler
+
+	// defined is true if a route is defined at the node, and paramNames then
+	// holds the names of the path params of the route in order.
+	defined    bool
+	paramNames []string
+}
+
+// pathParam is a path param child of a node. Path params with a constraint
+// are tried in the order defined, before the path param without constraint.
+// Routes with differently named path params share the same pathParam as long
+// as their constraints are equal; names are kept with each route.
+type pathParam struct {
+	names      []string
+	constraint *constraint
+	node       *node
+}
+
+// paramValue is a path param matched by node.match. Its name is filled in
+// once the route the path param belongs to is known. num holds the typed value
+// of path params having a typed constraint, to be interpreted according to
+// kind.
+type paramValue struct {
+	name  string
+	value string
+	kind  constraintKind
+	num   uint64
+}
+
+// clone returns a shallow copy of n with children and path params of its own,
+// which may be altered without affecting n.
+func (n *node) clone() *node {
+	c := *n
+	c.children = append([]*node(nil), n.children...)
+	c.pathParams = append([]*pathParam(nil), n.pathParams...)
+	return &c
+}
+
+// addStatic returns the node at the end of static path s below n, creating
+// nodes and splitting prefixes as needed. Prefixes are only split between
+// UTF-8 encoded characters, so children whose prefixes begin with different
+// multi-byte characters may share the same index byte. Existing nodes on the
+// way are replaced by clones, so n must itself be a clone.
+func (n *node) addStatic(s string) *node {
+	for s != "" {
+		var child *node
+		var i, l int
+		for i = 0; i < len(n.indices); i++ {
+			if n.indices[i] == s[0] {
+				if l = commonPrefixLen(n.children[i].prefix, s); l > 0 {
+					child = n.children[i]
+					break
+				}
+			}
+		}
+		if child == nil {
+			child = &node{prefix: s}
+			n.indices += s[:1]
+			n.children = append(n.children, child)
+			return child
+		}
+		child = child.clone()
+		n.children[i] = child
+		if l < len(child.prefix) {
+			split := &node{
+				prefix:   child.prefix[:l],
+				indices:  child.prefix[l : l+1],
+				children: []*node{child},
+			}
+			child.prefix = child.prefix[l:]
+			n.children[i] = split
+			child = split
+		}
+		n, s = child, s[l:]
+	}
+	return n
+}
+
+// staticChild returns the static child of n whose prefix is a prefix of path,
+// or nil if there is none.
+func (n *node) staticChild(path string) *node {
+	c := path[0]
+	for i := 0; i < len(n.indices); i++ {
+		j := strings.IndexByte(n.indices[i:], c)
+		if j < 0 {
+			return nil
+		}
+		i += j
+		if child := n.children[i]; strings.HasPrefix(path, child.prefix) {
+			return child
+		}
+		if c < utf8.RuneSelf {
+			return nil
+		}
+	}
+	return nil
+}
+
+// commonPrefixLen returns the length of the longest common prefix of a and b,
+// not splitting any UTF-8 encoded character.
+func commonPrefixLen(a, b string) int {
+	l := 0
+	for l < len(a) && l < len(b) && a[l] == b[l] {
+		l++
+	}
+	for l > 0 && l < len(a) && !utf8.RuneStart(a[l]) {
+		l--
+	}
+	return l
+}
+
+// addPathParam returns the node of the path param child of n defined by given
+// name and constraint pattern, creating it if needed. An existing path param
+// and its node are replaced by clones, so n must itself be a clone.
+func (n *node) addPathParam(name string, pattern string) (*node, error) {
+	for i, p := range n.pathParams {
+		if p.constraint.String() == pattern {
+			clone := *p
+			if !containsString(p.names, name) {
+				clone.names = append(p.names[:len(p.names):len(p.names)], name)
+			}
+			clone.node = p.node.clone()
+			n.pathParams[i] = &clone
+			return clone.node, nil
+		}
+	}
+	c, err := newConstraint(pattern)
+	if err != nil {
+		return nil, err
+	}
+	p := &pathParam{names: []string{name}, constraint: c, node: &node{}}
+	n.pathParams = append(n.pathParams, p)
+	if last := len(n.pathParams) - 1; c != nil && last > 0 && n.pathParams[last-1].constraint == nil {
+		n.pathParams[last-1], n.pathParams[last] = p, n.pathParams[last-1]
+	}
+	return p.node, nil
+}
+
+func containsString(ss []string, s string) bool {
+	for _, t := range ss {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
+
+// updateRoute returns a copy of n with f applied to a copy of the node of the
+// route defined by path, which is the part of the route path below n, given
+// that the path params of the route above n are named names. segmentStart
+// tells whether path begins a path segment. Nodes left without routes are
+// pruned, and static nodes left without route, path params and catch-all but
+// with a single static child are merged with the child. It returns nil if
+// nothing is left of n, and false if the route is not defined.
+func (n *node) updateRoute(path string, segmentStart bool, names []string, f func(*node)) (*node, bool) {
+	c := n.clone()
+	switch {
+	case path == "":
+		if !n.defined || len(n.paramNames) != len(names) {
+			return nil, false
+		}
+		for i, name := range n.paramNames {
+			if name != names[i] {
+				return nil, false
+			}
+		}
+		f(c)
+	case segmentStart && path[0] == ':':
+		segment, rest := splitSegment(path)
+		name, pattern, err := splitConstraint(segment[1:])
+		if err != nil {
+			return nil, false
+		}
+		i := 0
+		for i < len(c.pathParams) && c.pathParams[i].constraint.String() != pattern {
+			i++
+		}
+		if i == len(c.pathParams) {
+			return nil, false
+		}
+		p := *c.pathParams[i]
+		child, ok := p.node.updateRoute(rest, false, append(names, name), f)
+		if !ok {
+			return nil, false
+		}
+		if child == nil {
+			c.pathParams = append(c.pathParams[:i], c.pathParams[i+1:]...)
+			break
+		}
+		p.node, p.names = child, nil
+		for _, name := range c.pathParams[i].names {
+			if child.usesParamName(len(names), name) {
+				p.names = append(p.names, name)
+			}
+		}
+		c.pathParams[i] = &p
+	case segmentStart && path[0] == '*':
+		if c.catchAll.node == nil || c.catchAll.name != path[1:] {
+			return nil, false
+		}
+		child, ok := c.catchAll.node.updateRoute("", false, append(names, path[1:]), f)
+		if !ok {
+			return nil, false
+		}
+		c.catchAll.node = child
+		if child == nil {
+			c.catchAll.name = ""
+		}
+	default:
+		i := 0
+		for i < len(c.children) && !strings.HasPrefix(path, c.children[i].prefix) {
+			i++
+		}
+		if i == len(c.children) {
+			return nil, false
+		}
+		prefix := c.children[i].prefix
+		child, ok := c.children[i].updateRoute(path[len(prefix):], strings.HasSuffix(prefix, "/"), names, f)
+		if !ok {
+			return nil, false
+		}
+		if child == nil {
+			c.children = append(c.children[:i], c.children[i+1:]...)
+			c.indices = c.indices[:i] + c.indices[i+1:]
+		} else {
+			c.children[i] = child
+		}
+	}
+	if c.defined || len(c.pathParams) > 0 || c.catchAll.node != nil {
+		return c, true
+	}
+	switch {
+	case len(c.children) == 0:
+		return nil, true
+	case len(c.children) == 1 && c.prefix != "":
+		child := c.children[0].clone()
+		child.prefix = c.prefix + child.prefix
+		return child, true
+	}
+	return c, true
+}
+
+// usesParamName reports whether a route below n names its path param number k
+// name.
+func (n *node) usesParamName(k int, name string) bool {
+	if n.defined && k < len(n.paramNames) && n.paramNames[k] == name {
+		return true
+	}
+	for _, child := range n.children {
+		if child.usesParamName(k, name) {
+			return true
+		}
+	}
+	for _, p := range n.pathParams {
+		if p.node.usesParamName(k, name) {
+			return true
+		}
+	}
+	return n.catchAll.node != nil && n.catchAll.node.usesParamName(k, name)
+}
+
+// match walks the tree from n along path, which is the part of the requested
+// path below n, and returns the node of the route matching it along with the
+// values of its path params appended to values. It returns nil if no route
+// matches.
+//
+// Where a path segment begins the alternatives are tried in order of
+// precedence, backtracking to the next alternative if the rest of the path
+// does not match below the previous one:
+//
+//  1. the static segment
+//  2. path params with constraints, in the order defined, if the constraint
+//     is satisfied by the segment
+//  3. the path param without constraint
+//  4. the catch-all, which matches the rest of the path if it is not empty
+//
+// Path params do not match empty segments. Matching static routes does not
+// allocate.
+func (n *node) match(path string, values []paramValue) (*node, []paramValue) {
+	// Descend without recursion while there is nothing to backtrack to
+	for path != "" && len(n.pathParams) == 0 && n.catchAll.node == nil {
+		child := n.staticChild(path)
+		if child == nil {
+			return nil, values
+		}
+		n, path = child, path[len(child.prefix):]
+	}
+	if path == "" {
+		if n.handler != nil {
+			return n, values
+		}
+		return nil, values
+	}
+	if child := n.staticChild(path); child != nil {
+		if found, v := child.match(path[len(child.prefix):], values); found != nil {
+			return found, v
+		}
+	}
+	if len(n.pathParams) > 0 {
+		segment, rest := splitSegment(path)
+		if segment != "" {
+			for _, p := range n.pathParams {
+				num, ok := p.constraint.check(segment)
+				if !ok {
+					continue
+				}
+				v := append(values, paramValue{value: segment, kind: p.constraint.typeKind(), num: num})
+				if found, v := p.node.match(rest, v); found != nil {
+					return found, v
+				}
+			}
+		}
+	}
+	if n.catchAll.node != nil && n.catchAll.node.handler != nil {
+		return n.catchAll.node, append(values, paramValue{value: path})
+	}
+	return nil, values
+}
+
+// fixCase walks the tree from n along path like match does, appending the path
+// with the case of its static parts changed to match the tree to fixed. Exact
+// matches are tried before case-insensitive ones, which are tried before path
+// params and catch-alls. Characters whose case-folded forms differ in encoded
+// length are not matched case-insensitively.
+func (n *node) fixCase(path string, fixed []byte) ([]byte, bool) {
+	if path == "" {
+		return fixed, n.handler != nil
+	}
+	if child := n.staticChild(path); child != nil {
+		if result, ok := child.fixCase(path[len(child.prefix):], append(fixed, child.prefix...)); ok {
+			return result, true
+		}
+	}
+	for _, child := range n.children {
+		l := len(child.prefix)
+		if l > len(path) || path[:l] == child.prefix || !strings.EqualFold(path[:l], child.prefix) {
+			continue
+		}
+		if result, ok := child.fixCase(path[l:], append(fixed, child.prefix...)); ok {
+			return result, true
+		}
+	}
+	if len(n.pathParams) > 0 {
+		segment, rest := splitSegment(path)
+		if segment != "" {
+			for _, p := range n.pathParams {
+				if _, ok := p.constraint.check(segment); !ok {
+					continue
+				}
+				if result, ok := p.node.fixCase(rest, append(fixed, segment...)); ok {
+					return result, true
+				}
+			}
+		}
+	}
+	if n.catchAll.node != nil && n.catchAll.node.handler != nil {
+		return append(fixed, path...), true
+	}
+	return nil, false
+}
+
+// splitSegment splits path into its first segment and the rest, which is
+// either empty or begins with a slash.
+func splitSegment(path string) (segment string, rest string) {
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		return path[:i], path[i:]
+	}
+	return path, ""
+}
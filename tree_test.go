@@ -0,0 +1,116 @@
+package moku
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAddStatic(t *testing.T) {
+	root := &node{}
+	for _, s := range []string{"foo/bar", "foo/baz", "foo", "fob", "foo/bar/qux"} {
+		root.addStatic(s).handler = HandlerFunc(nil)
+	}
+
+	expectations := []struct {
+		path          string
+		expectedNodes []string
+	}{
+		{"foo/bar", []string{"fo", "o", "/ba", "r"}},
+		{"foo/baz", []string{"fo", "o", "/ba", "z"}},
+		{"foo", []string{"fo", "o"}},
+		{"fob", []string{"fo", "b"}},
+		{"foo/bar/qux", []string{"fo", "o", "/ba", "r", "/qux"}},
+	}
+	for _, e := range expectations {
+		var gotNodes []string
+		n, path := root, e.path
+		for path != "" {
+			child := n.staticChild(path)
+			gotNodes = append(gotNodes, child.prefix)
+			n, path = child, path[len(child.prefix):]
+		}
+		if !splitSlicesEqual(gotNodes, e.expectedNodes) {
+			t.Errorf("Expected nodes %q for %s, got %q", e.expectedNodes, e.path, gotNodes)
+		}
+		if n.handler == nil {
+			t.Errorf("Expected handler at %s", e.path)
+		}
+	}
+	if len(root.children) != 1 {
+		t.Errorf("Expected 1 child of root, got %d", len(root.children))
+	}
+}
+
+func TestCommonPrefixLen(t *testing.T) {
+	expectations := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"foo", "", 0},
+		{"foo", "foo", 3},
+		{"foo", "foobar", 3},
+		{"foobar", "foo", 3},
+		{"foo", "fob", 2},
+		{"bär", "bår", 1},
+		{"äa", "äb", 2},
+	}
+	for _, e := range expectations {
+		if got := commonPrefixLen(e.a, e.b); got != e.expected {
+			t.Errorf("commonPrefixLen(%q, %q) = %d, expected %d", e.a, e.b, got, e.expected)
+		}
+	}
+}
+
+func TestMuxUnicodeRoutes(t *testing.T) {
+	mux := newMuxWithGetPaths([]string{"/bär", "/bår", "/bä/:x"})
+	mux.RedirectCaseInsensitive = true
+
+	assertBodyEquals(t, mux, "GET", "/bär", "/bär")
+	assertBodyEquals(t, mux, "GET", "/bår", "/bår")
+	assertBodyEquals(t, mux, "GET", "/bä/x", "/bä/:x")
+	assertHeader(t, mux, "GET", "/BÄR", "Location", "/b%C3%A4r")
+	assertHeader(t, mux, "GET", "/BÅR", "Location", "/b%C3%A5r")
+	assertStatus(t, mux, "GET", "/bor", http.StatusNotFound)
+}
+
+func TestUpdateRoutePrunes(t *testing.T) {
+	r := &routes{trees: make(map[string]*node)}
+	for _, path := range []string{"/foo/bar", "/foo/baz", "/users/:id", "/users/:name/posts"} {
+		if err := r.addRoute("GET", path, HandlerFunc(nil), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	remove := func(path string) {
+		root, ok := r.trees["GET"].updateRoute(path[1:], true, nil, func(n *node) {
+			n.handler = nil
+			n.defined = false
+			n.paramNames = nil
+		})
+		if !ok {
+			t.Fatalf("Expected %s to be defined", path)
+		}
+		r.trees["GET"] = root
+	}
+
+	remove("/foo/baz")
+	root := r.trees["GET"]
+	if child := root.staticChild("foo/bar"); child == nil || child.prefix != "foo/bar" {
+		t.Errorf("Expected foo/ba and r to be merged into foo/bar, got %+v", child)
+	}
+
+	remove("/users/:name/posts")
+	users := r.trees["GET"].staticChild("users/")
+	if users == nil || len(users.pathParams) != 1 {
+		t.Fatalf("Expected users/ to have 1 path param, got %+v", users)
+	}
+	if p := users.pathParams[0]; !splitSlicesEqual(p.names, []string{"id"}) || len(p.node.children) != 0 {
+		t.Errorf("Expected only :id to be left, got %q with %d children", p.names, len(p.node.children))
+	}
+
+	remove("/users/:id")
+	remove("/foo/bar")
+	if r.trees["GET"] != nil {
+		t.Errorf("Expected nothing to be left, got %+v", r.trees["GET"])
+	}
+}